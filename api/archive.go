@@ -0,0 +1,258 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// SheetValues is everything in one tab of a spreadsheet.
+type SheetValues struct {
+	Title  string          `json:"title"`
+	Values [][]interface{} `json:"values"`
+}
+
+// ReadAllValues reads every tab of a spreadsheet, so volunteers' notes can be
+// kept before the spreadsheet goes away.
+func (c *Client) ReadAllValues(ctx context.Context, spreadsheetId string) ([]SheetValues, error) {
+	spreadsheet, err := c.sheets.Spreadsheets.Get(spreadsheetId).Fields("sheets.properties.title").Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	ranges := make([]string, len(spreadsheet.Sheets))
+	for i, s := range spreadsheet.Sheets {
+		ranges[i] = quoteSheetName(s.Properties.Title)
+	}
+	resp, err := c.sheets.Spreadsheets.Values.BatchGet(spreadsheetId).Ranges(ranges...).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	tabs := make([]SheetValues, len(resp.ValueRanges))
+	for i, vr := range resp.ValueRanges {
+		tabs[i] = SheetValues{Title: spreadsheet.Sheets[i].Properties.Title, Values: vr.Values}
+	}
+	return tabs, nil
+}
+
+// A bare sheet name as an A1 range, quoted so spaces and such don't trip it up
+func quoteSheetName(title string) string {
+	return "'" + strings.ReplaceAll(title, "'", "''") + "'"
+}
+
+// ArchiveToCSV writes every row of every tab of each spreadsheet into one CSV,
+// prefixed with where it came from: source title, source ID, tab. The header
+// is left off when appending to an earlier archive.
+func (c *Client) ArchiveToCSV(ctx context.Context, out io.Writer, driveFiles []*DriveFile, header bool) error {
+	w := csv.NewWriter(out)
+	if header {
+		w.Write(csvArchiveHeader)
+	}
+	for _, f := range driveFiles {
+		log.Printf("Archiving %s", f.Name)
+		tabs, err := c.ReadAllValues(ctx, f.Id)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", f.Name, err)
+		}
+		for _, tab := range tabs {
+			for _, row := range tab.Values {
+				record := []string{f.Name, f.Id, tab.Title}
+				for _, cell := range row {
+					record = append(record, fmt.Sprint(cell))
+				}
+				w.Write(record)
+			}
+		}
+		// Whole spreadsheets at a time, so a rerun can tell what made it
+		w.Flush()
+	}
+	w.Flush()
+	return w.Error()
+}
+
+var csvArchiveHeader = []string{"source_title", "source_id", "tab"}
+
+// ArchivedIds reads the source IDs out of an earlier ArchiveToCSV, so a rerun
+// after some removals failed can skip what's already archived. An empty
+// archive has none.
+func ArchivedIds(r io.Reader) (map[string]bool, error) {
+	ids := make(map[string]bool)
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return ids, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < len(csvArchiveHeader) {
+			return nil, fmt.Errorf("not a turnout archive: %q", record)
+		}
+		if record[1] != csvArchiveHeader[1] {
+			ids[record[1]] = true
+		}
+	}
+}
+
+// ArchiveToDir writes each spreadsheet into dir, creating it if needed. With
+// format "csv" that's one file per tab; with "json" it's one file per
+// spreadsheet holding every tab. Files already there are from an earlier run
+// into the same dir and are kept as they are.
+func (c *Client) ArchiveToDir(ctx context.Context, dir string, format string, driveFiles []*DriveFile) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	for _, f := range driveFiles {
+		jsonPath := filepath.Join(dir, archiveFileName(f.Name, f.Id)+".json")
+		if format == "json" && fileExists(jsonPath) {
+			log.Printf("Already archived %s", f.Name)
+			continue
+		}
+		log.Printf("Archiving %s", f.Name)
+		tabs, err := c.ReadAllValues(ctx, f.Id)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", f.Name, err)
+		}
+		switch format {
+		case "json":
+			err = writeJSONArchive(jsonPath, f, tabs)
+		default:
+			for _, tab := range tabs {
+				path := filepath.Join(dir, archiveFileName(f.Name+" - "+tab.Title, f.Id)+".csv")
+				if fileExists(path) {
+					continue
+				}
+				if err = writeCSVArchive(path, tab.Values); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("archiving %s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// Titles can hold slashes (dates!) and worse; the ID keeps names unique
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9 ._-]+`)
+
+func archiveFileName(title string, id string) string {
+	return strings.TrimSpace(unsafeFileChars.ReplaceAllString(title, "_")) + " [" + id + "]"
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Writes a new archive file, never clobbering one that's there. It's written
+// to a temp file and linked into place, so an existing file is always a
+// whole one and safe for a rerun to skip.
+func writeArchiveFile(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".archive-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	err = write(tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Link(tmp.Name(), path)
+}
+
+func writeCSVArchive(path string, values [][]interface{}) error {
+	return writeArchiveFile(path, func(out io.Writer) error {
+		w := csv.NewWriter(out)
+		for _, row := range values {
+			record := make([]string, len(row))
+			for i, cell := range row {
+				record[i] = fmt.Sprint(cell)
+			}
+			w.Write(record)
+		}
+		w.Flush()
+		return w.Error()
+	})
+}
+
+func writeJSONArchive(path string, f *DriveFile, tabs []SheetValues) error {
+	return writeArchiveFile(path, func(out io.Writer) error {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Title       string        `json:"title"`
+			Id          string        `json:"id"`
+			CreatedTime string        `json:"createdTime"`
+			Tabs        []SheetValues `json:"tabs"`
+		}{f.Name, f.Id, f.CreatedTime.Format(time.RFC3339), tabs})
+	})
+}
+
+// ArchiveToSpreadsheet appends every row of every tab of each spreadsheet to
+// the first tab of the archive spreadsheet, prefixed with source title,
+// source ID and tab, one append per source spreadsheet.
+func (c *Client) ArchiveToSpreadsheet(ctx context.Context, archiveId string, driveFiles []*DriveFile) error {
+	for _, f := range driveFiles {
+		log.Printf("Archiving %s", f.Name)
+		tabs, err := c.ReadAllValues(ctx, f.Id)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", f.Name, err)
+		}
+		var rows [][]interface{}
+		for _, tab := range tabs {
+			for _, row := range tab.Values {
+				rows = append(rows, append([]interface{}{f.Name, f.Id, tab.Title}, row...))
+			}
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		_, err = c.sheets.Spreadsheets.Values.Append(archiveId, "A1", &sheets.ValueRange{
+			MajorDimension: "ROWS",
+			Values:         rows,
+		}).ValueInputOption("RAW").InsertDataOption("INSERT_ROWS").Context(ctx).Do()
+		if err != nil {
+			return fmt.Errorf("appending %s to archive: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+var spreadsheetUrlPattern = regexp.MustCompile(`docs\.google\.com/spreadsheets/d/([A-Za-z0-9_-]+)`)
+var spreadsheetIdPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{25,}$`)
+
+// SpreadsheetIdFromURL pulls a spreadsheet ID out of a Sheets URL.
+func SpreadsheetIdFromURL(s string) (string, bool) {
+	if m := spreadsheetUrlPattern.FindStringSubmatch(s); m != nil {
+		return m[1], true
+	}
+	return "", false
+}
+
+// SpreadsheetIdFromString pulls a spreadsheet ID out of a Sheets URL, or
+// accepts a bare ID. Anything else isn't a spreadsheet.
+func SpreadsheetIdFromString(s string) (string, bool) {
+	if id, ok := SpreadsheetIdFromURL(s); ok {
+		return id, true
+	}
+	if spreadsheetIdPattern.MatchString(s) {
+		return s, true
+	}
+	return "", false
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type spreadsheetIdTestConf struct {
+	given    string
+	expected string
+	ok       bool
+}
+
+var spreadsheetIdTests = []spreadsheetIdTestConf{
+	{"https://docs.google.com/spreadsheets/d/1aB2cD3eF4gH5iJ6kL7mN8oP9qR0sT_uVwXyZ-abcdef/edit#gid=0", "1aB2cD3eF4gH5iJ6kL7mN8oP9qR0sT_uVwXyZ-abcdef", true},
+	{"1aB2cD3eF4gH5iJ6kL7mN8oP9qR0sT_uVwXyZ-abcdef", "1aB2cD3eF4gH5iJ6kL7mN8oP9qR0sT_uVwXyZ-abcdef", true},
+	{"archive", "", false},
+	{"./old-turnout", "", false},
+	{"old.csv", "", false},
+}
+
+func TestSpreadsheetIdFromString(t *testing.T) {
+	for _, test := range spreadsheetIdTests {
+		actual, ok := SpreadsheetIdFromString(test.given)
+		if actual != test.expected || ok != test.ok {
+			t.Fatalf("Wrong ID for %q; expected %q (%v), got %q (%v)", test.given, test.expected, test.ok, actual, ok)
+		}
+	}
+}
+
+func TestArchiveFileName(t *testing.T) {
+	actual := archiveFileName("IC Turnout - 1/5 - Group 3: Sam's", "abc123")
+	expected := "IC Turnout - 1_5 - Group 3_ Sam_s [abc123]"
+	if actual != expected {
+		t.Fatalf("Wrong file name; expected %q, got %q", expected, actual)
+	}
+}
+
+func TestWriteCSVArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tab.csv")
+	values := [][]interface{}{{"Name", "Phone", "Status"}, {"Ana", "555-0101", "Yes, texted"}}
+	if err := writeCSVArchive(path, values); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error reading archive: %v", err)
+	}
+	expected := "Name,Phone,Status\nAna,555-0101,\"Yes, texted\"\n"
+	if string(b) != expected {
+		t.Fatalf("Wrong CSV; expected %q, got %q", expected, string(b))
+	}
+	// Never clobber an earlier archive
+	if err := writeCSVArchive(path, values); err == nil {
+		t.Fatalf("Expected error overwriting existing archive")
+	}
+}
+
+func TestArchivedIds(t *testing.T) {
+	archive := "source_title,source_id,tab\nTurnout 1,1abc,Sheet1,Ana,555-0101\nTurnout 1,1abc,Sheet1,Ben\nTurnout 2,2def,Notes\n"
+	ids, err := ArchivedIds(strings.NewReader(archive))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(ids) != 2 || !ids["1abc"] || !ids["2def"] {
+		t.Fatalf("Wrong archived IDs; expected 1abc and 2def, got %v", ids)
+	}
+	if ids, err := ArchivedIds(strings.NewReader("")); err != nil || len(ids) != 0 {
+		t.Fatalf("Expected no IDs from an empty archive, got %v (%v)", ids, err)
+	}
+	if _, err := ArchivedIds(strings.NewReader("Name,Phone\nAna,555-0101\n")); err == nil {
+		t.Fatalf("Expected an error for a CSV that isn't an archive")
+	}
+}
+
+func TestArchiveToDirSkipsArchived(t *testing.T) {
+	dir := t.TempDir()
+	f := &DriveFile{Name: "Turnout 1/5 - Group 1", Id: "1abc"}
+	path := filepath.Join(dir, archiveFileName(f.Name, f.Id)+".json")
+	if err := os.WriteFile(path, []byte("earlier run"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// No Sheets client: reading anything would panic, so this only passes if
+	// the archived file is skipped without a read
+	if err := (&Client{}).ArchiveToDir(context.Background(), dir, "json", []*DriveFile{f}); err != nil {
+		t.Fatalf("Expected an earlier archive to be skipped, got %v", err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "earlier run" {
+		t.Fatalf("Expected the earlier archive to be kept, got %q", b)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("Expected no temp files left behind, got %v", entries)
+	}
+}
@@ -6,61 +6,418 @@ import (
 	"log"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"go-ogle-sheets/conf"
 	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/drive/v3"
 )
 
+// Where we look for credentials when --credentials isn't given, before
+// falling back to Application Default Credentials
+const defaultCredentialsFile = "credentials.json"
+
+// Where tokens used to live, before they moved under the config dir
+const legacyTokenFile = "token.json"
+
+// Tokens saved before we kept track of scopes were always for all of Drive
+var legacyScopes = []string{drive.DriveScope}
+
+// Just enough of a credentials file to tell what kind it is. OAuth client
+// files have an "installed" or "web" section; everything else has a "type".
+type credentialsKind struct {
+	Type      string          `json:"type"`
+	Installed json.RawMessage `json:"installed"`
+	Web       json.RawMessage `json:"web"`
+}
+
+func (k credentialsKind) String() string {
+	if k.Installed != nil || k.Web != nil {
+		return "oauth_client"
+	}
+	return k.Type
+}
+
+// Reads the credentials file, or returns nil bytes if we should use ADC
+func readCredentials(auth conf.AuthConfig) ([]byte, string, error) {
+	path := auth.CredentialsFile
+	if path == "" {
+		path = defaultCredentialsFile
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && auth.CredentialsFile == "" {
+		return nil, path, nil
+	}
+	return b, path, err
+}
+
+func credentialsKindOf(b []byte, path string) (credentialsKind, error) {
+	var kind credentialsKind
+	if err := json.Unmarshal(b, &kind); err != nil {
+		return kind, fmt.Errorf("%s isn't valid JSON: %w", path, err)
+	}
+	return kind, nil
+}
+
+// getClient picks an auth method from the credentials JSON: an OAuth client
+// means the browser flow for a user, a service account key means a JWT (acting
+// as auth.Impersonate if set), and anything else Google understands is used
+// as-is. With no credentials file at all we use Application Default
+// Credentials, so scheduled runs can go without any files.
+func getClient(ctx context.Context, auth conf.AuthConfig, scopes ...string) (*http.Client, error) {
+	ts, err := getTokenSource(ctx, auth, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	return oauth2.NewClient(ctx, ts), nil
+}
+
+func getTokenSource(ctx context.Context, auth conf.AuthConfig, scopes ...string) (oauth2.TokenSource, error) {
+	b, path, err := readCredentials(auth)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		log.Printf("No %s; using Application Default Credentials", defaultCredentialsFile)
+		if auth.Impersonate != "" {
+			return nil, errors.New("--impersonate needs a service account key passed with --credentials")
+		}
+		creds, err := google.FindDefaultCredentials(ctx, scopes...)
+		if err != nil {
+			return nil, fmt.Errorf("no credentials file and no Application Default Credentials: %w", err)
+		}
+		return creds.TokenSource, nil
+	}
+
+	kind, err := credentialsKindOf(b, path)
+	if err != nil {
+		return nil, err
+	}
+	if kind.Type != "service_account" && auth.Impersonate != "" {
+		return nil, fmt.Errorf("--impersonate only works with a service account key, and %s isn't one", path)
+	}
+	switch {
+	case kind.Installed != nil || kind.Web != nil:
+		authConfig, err := google.ConfigFromJSON(b, scopes...)
+		if err != nil {
+			return nil, err
+		}
+		store, err := newTokenStore(auth)
+		if err != nil {
+			return nil, err
+		}
+		return userTokenSource(ctx, authConfig, store, ownsLegacyToken(auth))
+	case kind.Type == "service_account":
+		jwtConfig, err := google.JWTConfigFromJSON(b, scopes...)
+		if err != nil {
+			return nil, err
+		}
+		// Domain-wide delegation: act as this user rather than the service account
+		jwtConfig.Subject = auth.Impersonate
+		return jwtConfig.TokenSource(ctx), nil
+	default:
+		creds, err := google.CredentialsFromJSON(ctx, b, scopes...)
+		if err != nil {
+			return nil, fmt.Errorf("don't know how to use %s (type %q): %w", path, kind.Type, err)
+		}
+		return creds.TokenSource, nil
+	}
+}
+
 // Retrieve a token, saves the token, then returns the generated client.
-func GetClient(config *oauth2.Config) *http.Client {
-	// The file token.json stores the user's access and refresh tokens, and is
-	// created automatically when the authorization flow completes for the first
-	// time.
-	tokFile := "token.json"
-	tok, err := tokenFromFile(tokFile)
+func GetClient(ctx context.Context, config *oauth2.Config, store TokenStore) (*http.Client, error) {
+	ts, err := userTokenSource(ctx, config, store, false)
+	if err != nil {
+		return nil, err
+	}
+	return oauth2.NewClient(ctx, ts), nil
+}
+
+// Loads the user's token (signing in through the browser if there isn't one)
+// and wraps it so refreshed tokens get written back to the store. If the token
+// doesn't cover config.Scopes, we go back to the browser and ask for just the
+// extra access, keeping what was already granted.
+func userTokenSource(ctx context.Context, config *oauth2.Config, store TokenStore, migrate bool) (oauth2.TokenSource, error) {
+	tok, granted, err := loadToken(store, migrate)
+	var missing []string
+	if err == nil {
+		missing = missingScopes(granted, config.Scopes)
+	}
+	if err != nil || len(missing) > 0 {
+		if err == nil {
+			log.Printf("This needs more access than turnout has been given (%s); opening the browser to ask", strings.Join(missing, ", "))
+		} else {
+			granted = nil
+		}
+		tok, granted, err = signIn(ctx, config, granted)
+		if err != nil {
+			return nil, err
+		}
+		if err := store.Save(tok, granted); err != nil {
+			log.Printf("Unable to cache oauth token, you'll have to sign in again next time: %v", err)
+		}
+	}
+	return newSavingTokenSource(config.TokenSource(ctx, tok), tok, func(t *oauth2.Token) error {
+		return store.Save(t, granted)
+	}), nil
+}
+
+// signIn runs the browser flow for config.Scopes. With scopes already granted,
+// it's incremental authorization: Google only asks about the new ones, and the
+// token we get back covers both.
+func signIn(ctx context.Context, config *oauth2.Config, granted []string) (*oauth2.Token, []string, error) {
+	var opts []oauth2.AuthCodeOption
+	if granted != nil {
+		c := *config
+		c.Scopes = unionScopes(granted, config.Scopes...)
+		config = &c
+		opts = append(opts, oauth2.SetAuthURLParam("include_granted_scopes", "true"))
+	}
+	tok, err := getTokenFromWeb(ctx, config, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Google says what was actually granted, which can be less than we asked for
+	scopes := config.Scopes
+	if s, ok := tok.Extra("scope").(string); ok && s != "" {
+		scopes = strings.Fields(s)
+	}
+	return tok, scopes, nil
+}
+
+// Reads the token from the store, or (if migrate) from ./token.json where it
+// used to live, moving it over if so (and encrypting it, for the encrypted
+// store).
+func loadToken(store TokenStore, migrate bool) (*oauth2.Token, []string, error) {
+	tok, scopes, err := store.Load()
+	if err == nil || !migrate || !errors.Is(err, os.ErrNotExist) || store.String() == legacyTokenFile {
+		return tok, scopes, err
+	}
+	if _, ok := store.(*MemoryTokenStore); ok {
+		return nil, nil, err
+	}
+	legacy := &FileTokenStore{Path: legacyTokenFile}
+	tok, scopes, legacyErr := legacy.Load()
+	if legacyErr != nil {
+		return nil, nil, err
+	}
+	log.Printf("Moving %s to %s", legacy, store)
+	if err := store.Save(tok, scopes); err == nil {
+		legacy.Delete()
+	}
+	return tok, scopes, nil
+}
+
+// ./token.json was whoever signed in before profiles and accounts existed,
+// so only the default token takes it over. A profile or account picking it up
+// would quietly run as the wrong Google account.
+func ownsLegacyToken(auth conf.AuthConfig) bool {
+	return auth.Account == "" && auth.TokenFile == conf.TokenPath("", "")
+}
+
+// savingTokenSource hands out tokens from base and saves any that are new,
+// so a refreshed access token (or rotated refresh token) survives the run.
+type savingTokenSource struct {
+	mu   sync.Mutex
+	base oauth2.TokenSource
+	last *oauth2.Token
+	save func(*oauth2.Token) error
+}
+
+func newSavingTokenSource(base oauth2.TokenSource, current *oauth2.Token, save func(*oauth2.Token) error) *savingTokenSource {
+	return &savingTokenSource{base: base, last: current, save: save}
+}
+
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	tok, err := s.base.Token()
 	if err != nil {
-		tok = getTokenFromWeb(config)
-		saveToken(tokFile, tok)
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.last == nil || tok.AccessToken != s.last.AccessToken || tok.RefreshToken != s.last.RefreshToken {
+		// Google doesn't always send the refresh token back; keep the one we have
+		if tok.RefreshToken == "" && s.last != nil {
+			tok.RefreshToken = s.last.RefreshToken
+		}
+		if err := s.save(tok); err != nil {
+			log.Printf("Unable to save refreshed oauth token: %v", err)
+		}
+		s.last = tok
 	}
-	return config.Client(context.Background(), tok)
+	return tok, nil
 }
 
+// How long to wait for someone to finish signing in in the browser
+const signInTimeout = 5 * time.Minute
+
 // Request a token from the web, then returns the retrieved token.
-func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
-	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	fmt.Printf("Go to the following link in your browser then type the "+
-		"authorization code: \n%v\n", authURL)
+func getTokenFromWeb(ctx context.Context, config *oauth2.Config, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
+	ctx, cancel := context.WithTimeout(ctx, signInTimeout)
+	defer cancel()
+	flow := newLoopbackFlow(config)
+	flow.options = opts
+	return flow.Token(ctx)
+}
 
-	var authCode string
-	if _, err := fmt.Scan(&authCode); err != nil {
-		log.Fatalf("Unable to read authorization code: %v", err)
+// Login runs the browser sign-in even if there's already a token, and saves
+// the result.
+func Login(ctx context.Context, auth conf.AuthConfig) error {
+	b, path, err := readCredentials(auth)
+	if err != nil {
+		return err
 	}
+	if b == nil {
+		return fmt.Errorf("no %s; logging in needs an OAuth client file (Application Default Credentials are managed by gcloud)", defaultCredentialsFile)
+	}
+	kind, err := credentialsKindOf(b, path)
+	if err != nil {
+		return err
+	}
+	if kind.Installed == nil && kind.Web == nil {
+		return fmt.Errorf("%s is a %s, which doesn't need logging in", path, kind)
+	}
+	// Commands ask for anything broader when they need it
+	authConfig, err := google.ConfigFromJSON(b, LoginScopes...)
+	if err != nil {
+		return err
+	}
+	tok, scopes, err := signIn(ctx, authConfig, nil)
+	if err != nil {
+		return err
+	}
+	store, err := newTokenStore(auth)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Saving token to %s\n", store)
+	return store.Save(tok, scopes)
+}
 
-	tok, err := config.Exchange(context.TODO(), authCode)
+// Logout revokes the saved token with Google and deletes it.
+func Logout(ctx context.Context, auth conf.AuthConfig) error {
+	store, err := newTokenStore(auth)
 	if err != nil {
-		log.Fatalf("Unable to retrieve token from web: %v", err)
+		return err
+	}
+	tok, _, err := store.Load()
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("not logged in (no token at %s)", store)
+	} else if err != nil {
+		return err
+	}
+	// Revoking the refresh token revokes the access tokens it made too
+	revoke := tok.RefreshToken
+	if revoke == "" {
+		revoke = tok.AccessToken
 	}
-	return tok
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://oauth2.googleapis.com/revoke", strings.NewReader(url.Values{"token": {revoke}}.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("Couldn't reach Google to revoke the token, deleting it anyway: %v", err)
+	} else {
+		resp.Body.Close()
+		// 400 means it was already revoked or expired, which is fine
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest {
+			log.Printf("Google returned %s revoking the token, deleting it anyway", resp.Status)
+		}
+	}
+	return store.Delete()
 }
 
-// Retrieves a token from a local file.
-func tokenFromFile(file string) (*oauth2.Token, error) {
-	f, err := os.Open(file)
+// AuthStatus describes who we're signed in as.
+type AuthStatus struct {
+	CredentialsType string
+	TokenStore      string // Only for OAuth clients
+	LoggedIn        bool
+	Account         string
+	Scopes          []string
+	Expiry          time.Time
+}
+
+// Status reports who we'd act as, without starting a sign-in.
+func Status(ctx context.Context, auth conf.AuthConfig) (*AuthStatus, error) {
+	status := &AuthStatus{CredentialsType: "application_default"}
+	// Whatever the token already has; asking for more would start a sign-in
+	scopes := LoginScopes
+	b, path, err := readCredentials(auth)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-	tok := &oauth2.Token{}
-	err = json.NewDecoder(f).Decode(tok)
-	return tok, err
+	if b != nil {
+		kind, err := credentialsKindOf(b, path)
+		if err != nil {
+			return nil, err
+		}
+		status.CredentialsType = kind.String()
+		if kind.Installed != nil || kind.Web != nil {
+			store, err := newTokenStore(auth)
+			if err != nil {
+				return nil, err
+			}
+			status.TokenStore = store.String()
+			if _, _, err := loadToken(store, ownsLegacyToken(auth)); err != nil {
+				return status, nil
+			}
+			scopes = nil
+		}
+	}
+
+	ts, err := getTokenSource(ctx, auth, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	tok, err := ts.Token()
+	if err != nil {
+		return nil, fmt.Errorf("token doesn't work (try `turnout auth login`): %w", err)
+	}
+	status.LoggedIn = true
+	status.Expiry = tok.Expiry
+
+	info, err := tokenInfo(ctx, tok.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	status.Account = info.Email
+	status.Scopes = strings.Fields(info.Scope)
+	if status.Account == "" {
+		// Only there with the email scope; Drive will tell us anyway
+		if c, err := NewClient(ctx, auth, scopes...); err == nil {
+			if about, err := c.drive.About.Get().Fields("user(emailAddress)").Context(ctx).Do(); err == nil {
+				status.Account = about.User.EmailAddress
+			}
+		}
+	}
+	return status, nil
+}
+
+type tokenInfoResponse struct {
+	Email string `json:"email"`
+	Scope string `json:"scope"`
 }
 
-// Saves a token to a file path.
-func saveToken(path string, token *oauth2.Token) {
-	fmt.Printf("Saving credential file to: %s\n", path)
-	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+func tokenInfo(ctx context.Context, accessToken string) (*tokenInfoResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://oauth2.googleapis.com/tokeninfo?access_token="+url.QueryEscape(accessToken), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		log.Fatalf("Unable to cache oauth token: %v", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("looking up token info: %s", resp.Status)
 	}
-	defer f.Close()
-	json.NewEncoder(f).Encode(token)
+	info := &tokenInfoResponse{}
+	return info, json.NewDecoder(resp.Body).Decode(info)
 }
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-ogle-sheets/conf"
+	"golang.org/x/oauth2"
+)
+
+func writeCredentials(t *testing.T, creds map[string]interface{}) string {
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	b, _ := json.Marshal(creds)
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		t.Fatalf("Failed to write credentials: %v", err)
+	}
+	return path
+}
+
+func serviceAccountKey(t *testing.T) map[string]interface{} {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	return map[string]interface{}{
+		"type":           "service_account",
+		"client_email":   "turnout@example.iam.gserviceaccount.com",
+		"private_key_id": "abc",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":      "https://oauth2.googleapis.com/token",
+	}
+}
+
+func TestGetClientServiceAccount(t *testing.T) {
+	path := writeCredentials(t, serviceAccountKey(t))
+	client, err := getClient(context.Background(), conf.AuthConfig{CredentialsFile: path, Impersonate: "organizer@example.org"}, "scope")
+	if err != nil || client == nil {
+		t.Fatalf("Expected a client for a service account key, got %v", err)
+	}
+}
+
+func TestGetClientImpersonateNeedsServiceAccount(t *testing.T) {
+	path := writeCredentials(t, map[string]interface{}{
+		"installed": map[string]interface{}{"client_id": "id", "client_secret": "secret", "redirect_uris": []string{"http://localhost"}},
+	})
+	_, err := getClient(context.Background(), conf.AuthConfig{CredentialsFile: path, Impersonate: "organizer@example.org"}, "scope")
+	if err == nil || !strings.Contains(err.Error(), "service account") {
+		t.Fatalf("Expected error impersonating without a service account, got %v", err)
+	}
+}
+
+func TestGetClientMissingExplicitFile(t *testing.T) {
+	// Only a missing default file falls back to ADC; a missing explicit one is a mistake
+	_, err := getClient(context.Background(), conf.AuthConfig{CredentialsFile: filepath.Join(t.TempDir(), "nope.json")}, "scope")
+	if err == nil {
+		t.Fatalf("Expected error for missing --credentials file")
+	}
+}
+
+type fakeTokenSource struct {
+	tokens []*oauth2.Token
+}
+
+func (f *fakeTokenSource) Token() (*oauth2.Token, error) {
+	tok := f.tokens[0]
+	if len(f.tokens) > 1 {
+		f.tokens = f.tokens[1:]
+	}
+	return tok, nil
+}
+
+func TestSavingTokenSource(t *testing.T) {
+	current := &oauth2.Token{AccessToken: "a", RefreshToken: "r"}
+	// Same token twice, then a refresh without a new refresh token
+	base := &fakeTokenSource{tokens: []*oauth2.Token{current, current, {AccessToken: "b"}}}
+	var saved []*oauth2.Token
+	ts := newSavingTokenSource(base, current, func(tok *oauth2.Token) error {
+		saved = append(saved, tok)
+		return nil
+	})
+	for i := 0; i < 3; i++ {
+		if _, err := ts.Token(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if len(saved) != 1 {
+		t.Fatalf("Wrong number of saves; expected %v, got %v", 1, len(saved))
+	}
+	if saved[0].AccessToken != "b" || saved[0].RefreshToken != "r" {
+		t.Fatalf("Wrong saved token; expected %v, got %v", "b/r", saved[0].AccessToken+"/"+saved[0].RefreshToken)
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+)
+
+type callCounterKey struct{}
+
+// withCallCounter returns a context whose API requests are counted, for
+// --verbose. Counting happens in the transport, so it's every request that
+// actually went out, failures and rollbacks included.
+func withCallCounter(ctx context.Context) (context.Context, *atomic.Int64) {
+	calls := &atomic.Int64{}
+	return context.WithValue(ctx, callCounterKey{}, calls), calls
+}
+
+// countingTransport bumps the counter in each request's context, if any
+type countingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if calls, ok := req.Context().Value(callCounterKey{}).(*atomic.Int64); ok {
+		calls.Add(1)
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// Counts requests made through client from here on
+func countCalls(client *http.Client) {
+	client.Transport = &countingTransport{base: client.Transport}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"go-ogle-sheets/conf"
+)
+
+// Sheets spells value input options in capitals
+func valueInputOption(valueInput string) string {
+	if valueInput == conf.ValueInputUserEntered {
+		return "USER_ENTERED"
+	}
+	return "RAW"
+}
+
+// phoneURI turns a number as people write it ("(555) 010-0100", "+1 555
+// 0100") into a tel: or sms: URI. Anything without digits isn't a number.
+func phoneURI(scheme string, number string) (string, bool) {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(number) {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && i == 0:
+			b.WriteRune(r)
+		}
+	}
+	digits := strings.TrimPrefix(b.String(), "+")
+	if digits == "" {
+		return "", false
+	}
+	return scheme + ":" + b.String(), true
+}
+
+// phoneCell is what goes in a contact's phone cell: the number itself, or a
+// HYPERLINK formula showing the number that opens the dialer or messages
+// app when tapped. sms: links carry body as the message, if there is one.
+func phoneCell(number interface{}, links string, body string) interface{} {
+	if links == "" || links == conf.PhoneLinksNone {
+		return number
+	}
+	text := fmt.Sprint(number)
+	uri, ok := phoneURI(links, text)
+	if !ok {
+		return number
+	}
+	if links == conf.PhoneLinksSMS && body != "" {
+		// Spaces have to be %20; messages apps show a + as a +
+		uri += "?body=" + strings.ReplaceAll(url.QueryEscape(body), "+", "%20")
+	}
+	return fmt.Sprintf("=HYPERLINK(%s, %s)", formulaString(uri), formulaString(text))
+}
+
+// A string literal for a formula; quotes are escaped by doubling them
+func formulaString(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"testing"
+
+	"go-ogle-sheets/conf"
+)
+
+type phoneCellTestConf struct {
+	number   interface{}
+	links    string
+	body     string
+	expected interface{}
+}
+
+var phoneCellTests = []phoneCellTestConf{
+	{"555-0100", conf.PhoneLinksNone, "", "555-0100"},
+	{"555-0100", "", "", "555-0100"},
+	{"(555) 010-0100", conf.PhoneLinksTel, "", `=HYPERLINK("tel:5550100100", "(555) 010-0100")`},
+	{"+1 555 010 0100", conf.PhoneLinksSMS, "", `=HYPERLINK("sms:+15550100100", "+1 555 010 0100")`},
+	{"0044 20 7946 0000", conf.PhoneLinksTel, "", `=HYPERLINK("tel:00442079460000", "0044 20 7946 0000")`},
+	{`555 "home"`, conf.PhoneLinksTel, "", `=HYPERLINK("tel:555", "555 ""home""")`},
+	{"ask Sam", conf.PhoneLinksTel, "", "ask Sam"},
+	{"+", conf.PhoneLinksSMS, "", "+"},
+	{"555-0100", conf.PhoneLinksSMS, "Hi Sam, it's Jo! See you at 6 & bring a friend?", `=HYPERLINK("sms:5550100?body=Hi%20Sam%2C%20it%27s%20Jo%21%20See%20you%20at%206%20%26%20bring%20a%20friend%3F", "555-0100")`},
+	{"555-0100", conf.PhoneLinksTel, "Hi Sam", `=HYPERLINK("tel:5550100", "555-0100")`},
+}
+
+func TestPhoneCell(t *testing.T) {
+	for _, test := range phoneCellTests {
+		got := phoneCell(test.number, test.links, test.body)
+		if got != test.expected {
+			t.Fatalf("Wrong phone cell for %q with %q; expected %v, got %v", test.number, test.links, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"log"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// This is goofy, but I'm just cruising through how go works again
+type DriveFile struct {
+	Name           string
+	Id             string
+	CreatedTime    time.Time
+	ModifiedTime   time.Time
+	LastModifiedBy string // Email address
+	Parents        []string
+	Owners         []string // Email addresses
+	AppProperties  map[string]string
+}
+
+// Managed reports whether generate made this file.
+func (f *DriveFile) Managed() bool {
+	return f.AppProperties[ManagedProperty] == "true"
+}
+
+// ModifiedByOthers reports whether someone other than an owner was the last
+// to touch the file, e.g. a volunteer filling in their batch.
+func (f *DriveFile) ModifiedByOthers() bool {
+	if f.LastModifiedBy == "" {
+		return false
+	}
+	for _, o := range f.Owners {
+		if o == f.LastModifiedBy {
+			return false
+		}
+	}
+	return true
+}
+
+// Only ask Drive for what DriveFile holds
+const driveFileFields = "nextPageToken, files(id, name, createdTime, modifiedTime, lastModifyingUser(emailAddress), parents, owners(emailAddress), appProperties)"
+
+// Drive caps pages at 1000; the default is 100
+const driveListPageSize = 1000
+
+// Returned from the Pages callback to stop early when the consumer breaks out
+var errStopPaging = errors.New("stop paging")
+
+func (c *Client) AllSpreadsheetsByQ(ctx context.Context, q *Query) ([]*DriveFile, error) {
+	var driveFiles []*DriveFile
+	for f, err := range c.SpreadsheetsByQ(ctx, q) {
+		if err != nil {
+			log.Printf("Error finding spreadsheets by name: %v", err)
+			return nil, err
+		}
+		driveFiles = append(driveFiles, f)
+	}
+	return driveFiles, nil
+}
+
+// SpreadsheetsByQ streams every spreadsheet matching q, fetching pages from
+// Drive as the loop goes. On failure it yields a nil file and the error, then
+// stops.
+func (c *Client) SpreadsheetsByQ(ctx context.Context, q *Query) iter.Seq2[*DriveFile, error] {
+	endQ := q.Clone().MimeType(spreadsheetMimeType).String()
+	return func(yield func(*DriveFile, error) bool) {
+		call := c.drive.Files.List().Q(endQ).PageSize(driveListPageSize).Fields(driveFileFields)
+		err := call.Pages(ctx, func(fileList *drive.FileList) error {
+			for _, f := range fileList.Files {
+				if !yield(newDriveFile(f), nil) {
+					return errStopPaging
+				}
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopPaging) {
+			yield(nil, err)
+		}
+	}
+}
+
+func newDriveFile(f *drive.File) *DriveFile {
+	driveFile := &DriveFile{Name: f.Name, Id: f.Id, Parents: f.Parents, AppProperties: f.AppProperties}
+	// RFC 3339, and always present since we ask for it
+	if t, err := time.Parse(time.RFC3339, f.CreatedTime); err == nil {
+		driveFile.CreatedTime = t
+	}
+	if t, err := time.Parse(time.RFC3339, f.ModifiedTime); err == nil {
+		driveFile.ModifiedTime = t
+	}
+	if f.LastModifyingUser != nil {
+		driveFile.LastModifiedBy = f.LastModifyingUser.EmailAddress
+	}
+	for _, o := range f.Owners {
+		driveFile.Owners = append(driveFile.Owners, o.EmailAddress)
+	}
+	return driveFile
+}
+
+// FolderNames looks up the names of the given folder IDs, each only once.
+// Folders we can't see are named by their ID rather than failing the lookup.
+func (c *Client) FolderNames(ctx context.Context, folderIds []string) map[string]string {
+	names := make(map[string]string)
+	for _, id := range folderIds {
+		if _, ok := names[id]; ok {
+			continue
+		}
+		f, err := c.drive.Files.Get(id).Fields("name").Context(ctx).Do()
+		if err != nil {
+			log.Printf("Couldn't look up folder %s: %v", id, err)
+			names[id] = id
+			continue
+		}
+		names[id] = f.Name
+	}
+	return names
+}
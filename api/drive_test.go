@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+// A fake Drive that serves files.list in two pages and remembers what it
+// was asked
+type fakeDrive struct {
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func (d *fakeDrive) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	d.requests = append(d.requests, r)
+	d.mu.Unlock()
+	page := &drive.FileList{
+		Files:         []*drive.File{{Id: "1", Name: "Turnout 1"}, {Id: "2", Name: "Turnout 2"}},
+		NextPageToken: "page2",
+	}
+	if r.URL.Query().Get("pageToken") == "page2" {
+		page = &drive.FileList{Files: []*drive.File{{Id: "3", Name: "Turnout 3", CreatedTime: "2025-01-05T12:00:00Z"}}}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func newFakeDriveClient(t *testing.T) (*Client, *fakeDrive) {
+	fake := &fakeDrive{}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	ctx := context.Background()
+	driveService, err := drive.NewService(ctx, option.WithEndpoint(srv.URL+"/"), option.WithHTTPClient(srv.Client()))
+	if err != nil {
+		t.Fatalf("Failed to make Drive service: %v", err)
+	}
+	return &Client{drive: driveService}, fake
+}
+
+func TestSpreadsheetsByQ(t *testing.T) {
+	client, fake := newFakeDriveClient(t)
+	files, err := client.AllSpreadsheetsByQ(context.Background(), NewQuery().Trashed(false))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var ids []string
+	for _, f := range files {
+		ids = append(ids, f.Id)
+	}
+	if strings.Join(ids, ",") != "1,2,3" {
+		t.Fatalf("Wrong files; expected 1,2,3 across both pages, got %v", ids)
+	}
+	if files[2].CreatedTime.IsZero() {
+		t.Fatalf("Expected createdTime to be parsed, got %+v", files[2])
+	}
+	if len(fake.requests) != 2 {
+		t.Fatalf("Wrong number of list calls; expected 2, got %d", len(fake.requests))
+	}
+	for _, r := range fake.requests {
+		query := r.URL.Query()
+		if query.Get("fields") != driveFileFields {
+			t.Fatalf("Wrong fields; expected %q, got %q", driveFileFields, query.Get("fields"))
+		}
+		if !strings.Contains(query.Get("q"), "trashed = false") || !strings.Contains(query.Get("q"), spreadsheetMimeType) {
+			t.Fatalf("Wrong query; expected trashed and mimeType clauses, got %q", query.Get("q"))
+		}
+	}
+}
+
+func TestSpreadsheetsByQStopsPaging(t *testing.T) {
+	client, fake := newFakeDriveClient(t)
+	seen := 0
+	for f, err := range client.SpreadsheetsByQ(context.Background(), NewQuery()) {
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		seen++
+		if f.Id == "1" {
+			break
+		}
+	}
+	if seen != 1 {
+		t.Fatalf("Expected the loop to stop after one file, got %d", seen)
+	}
+	if len(fake.requests) != 1 {
+		t.Fatalf("Expected breaking out to stop paging after 1 list call, got %d", len(fake.requests))
+	}
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"os/exec"
+	"runtime"
+
+	"golang.org/x/oauth2"
+)
+
+// loopbackFlow is the OAuth flow for installed apps: we listen on a random
+// port on 127.0.0.1, send the browser to Google with that as the redirect URI,
+// and pick the code up off the redirect ourselves. PKCE and a random state
+// keep anyone else from using or forging the code.
+type loopbackFlow struct {
+	config *oauth2.Config
+	// Called with the authorization URL. Tests swap this for a fake browser
+	openURL func(authURL string) error
+	// Extra parameters for the authorization URL, e.g. include_granted_scopes
+	options []oauth2.AuthCodeOption
+}
+
+func newLoopbackFlow(config *oauth2.Config) *loopbackFlow {
+	return &loopbackFlow{config: config, openURL: openInBrowser}
+}
+
+type loopbackResult struct {
+	code string
+	err  error
+}
+
+// Token runs the flow start to finish and returns the exchanged token.
+func (f *loopbackFlow) Token(ctx context.Context) (*oauth2.Token, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't listen for the OAuth redirect: %w", err)
+	}
+	defer listener.Close()
+
+	// Copy so the redirect URI doesn't stick to the shared config
+	config := *f.config
+	config.RedirectURL = fmt.Sprintf("http://%s/", listener.Addr().String())
+
+	state, err := randomState()
+	if err != nil {
+		return nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	results := make(chan loopbackResult, 1)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		query := r.URL.Query()
+		var result loopbackResult
+		switch {
+		case query.Get("state") != state:
+			// Not our redirect; leave the flow waiting for the real one
+			http.Error(w, "State mismatch; this isn't the sign-in turnout started.", http.StatusBadRequest)
+			return
+		case query.Get("error") != "":
+			result.err = fmt.Errorf("authorization failed: %s", query.Get("error"))
+		case query.Get("code") == "":
+			result.err = errors.New("authorization redirect had no code")
+		default:
+			result.code = query.Get("code")
+		}
+		if result.err != nil {
+			fmt.Fprintf(w, "<p>Sign-in failed: %s</p>", html.EscapeString(result.err.Error()))
+		} else {
+			fmt.Fprint(w, "<p>Signed in to turnout. You can close this window.</p>")
+		}
+		select {
+		case results <- result:
+		default:
+		}
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	opts := append([]oauth2.AuthCodeOption{oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier)}, f.options...)
+	authURL := config.AuthCodeURL(state, opts...)
+	fmt.Printf("Opening your browser to sign in. If it doesn't open, go to:\n%v\n", authURL)
+	if err := f.openURL(authURL); err != nil {
+		fmt.Printf("(Couldn't open a browser: %v)\n", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-results:
+		if result.err != nil {
+			return nil, result.err
+		}
+		tok, err := config.Exchange(ctx, result.code, oauth2.VerifierOption(verifier))
+		if err != nil {
+			return nil, fmt.Errorf("unable to retrieve token from web: %w", err)
+		}
+		return tok, nil
+	}
+}
+
+func randomState() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Best effort; the URL is always printed too
+func openInBrowser(url string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	default:
+		return exec.Command("xdg-open", url).Start()
+	}
+}
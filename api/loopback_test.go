@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// stubAuthServer plays Google: /auth hands out a code bound to the PKCE
+// challenge, /token only trades it for a token given the matching verifier.
+type stubAuthServer struct {
+	*httptest.Server
+	challenge   string
+	redirectURI string
+}
+
+func newStubAuthServer(t *testing.T) *stubAuthServer {
+	s := &stubAuthServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if r.Form.Get("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != s.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		if r.Form.Get("redirect_uri") != s.redirectURI {
+			http.Error(w, `{"error":"redirect_uri_mismatch"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access",
+			"refresh_token": "refresh",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		})
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *stubAuthServer) config() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:    "client",
+		Endpoint:    oauth2.Endpoint{AuthURL: s.URL + "/auth", TokenURL: s.URL + "/token"},
+		RedirectURL: "http://localhost",
+		Scopes:      []string{"scope"},
+	}
+}
+
+// fakeBrowser follows the auth URL the way a user approving access would,
+// letting the test tamper with the redirect first
+func (s *stubAuthServer) fakeBrowser(t *testing.T, tamper func(url.Values)) func(string) error {
+	return func(authURL string) error {
+		u, err := url.Parse(authURL)
+		if err != nil {
+			return err
+		}
+		q := u.Query()
+		if q.Get("code_challenge_method") != "S256" || q.Get("access_type") != "offline" {
+			t.Errorf("Auth URL is missing PKCE or offline access: %s", authURL)
+		}
+		if q.Get("state") == "" || q.Get("state") == "state-token" {
+			t.Errorf("Auth URL state isn't random: %q", q.Get("state"))
+		}
+		if !strings.HasPrefix(q.Get("redirect_uri"), "http://127.0.0.1:") {
+			t.Errorf("Redirect URI isn't a loopback address: %q", q.Get("redirect_uri"))
+		}
+		s.challenge = q.Get("code_challenge")
+		s.redirectURI = q.Get("redirect_uri")
+
+		redirect := url.Values{"code": {"good-code"}, "state": {q.Get("state")}}
+		if tamper != nil {
+			tamper(redirect)
+		}
+		go http.Get(s.redirectURI + "?" + redirect.Encode())
+		return nil
+	}
+}
+
+func TestLoopbackFlow(t *testing.T) {
+	s := newStubAuthServer(t)
+	flow := newLoopbackFlow(s.config())
+	flow.openURL = s.fakeBrowser(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tok, err := flow.Token(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if tok.AccessToken != "access" || tok.RefreshToken != "refresh" {
+		t.Fatalf("Wrong token; got %+v", tok)
+	}
+	if flow.config.RedirectURL != "http://localhost" {
+		t.Fatalf("Flow changed the shared config's redirect URL to %q", flow.config.RedirectURL)
+	}
+}
+
+func TestLoopbackFlowDenied(t *testing.T) {
+	s := newStubAuthServer(t)
+	flow := newLoopbackFlow(s.config())
+	flow.openURL = s.fakeBrowser(t, func(v url.Values) {
+		v.Del("code")
+		v.Set("error", "access_denied")
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := flow.Token(ctx); err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Fatalf("Expected access_denied error, got %v", err)
+	}
+}
+
+func TestLoopbackFlowIgnoresForgedState(t *testing.T) {
+	s := newStubAuthServer(t)
+	flow := newLoopbackFlow(s.config())
+	flow.openURL = s.fakeBrowser(t, func(v url.Values) {
+		v.Set("state", "forged")
+	})
+	// The forged redirect is rejected, so the flow keeps waiting until it times out
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if _, err := flow.Token(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected flow to time out ignoring forged state, got %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"go-ogle-sheets/conf"
+	"google.golang.org/api/sheets/v4"
+)
+
+// Background colors for status cells, so a sheet can be read at a glance.
+// "Not contacted" stays plain.
+var statusColors = map[string]*sheets.Color{
+	"Texted":       {Red: 0.81, Green: 0.89, Blue: 0.95},
+	"Yes":          {Red: 0.85, Green: 0.92, Blue: 0.83},
+	"No":           {Red: 0.96, Green: 0.8, Blue: 0.8},
+	"Maybe":        {Red: 1, Green: 0.95, Blue: 0.8},
+	"Wrong number": {Red: 0.85, Green: 0.85, Blue: 0.85},
+}
+
+// Whether a batch's sheet needs anything beyond its values, so templates
+// can stay minimal
+func needsFormatting(config conf.GenerationConfig) bool {
+	return containsString(config.Columns, conf.ColumnStatus) || config.FreezeHeader || config.ProtectContacts
+}
+
+// Adds the status dropdown and colors, freezes the header and protects the
+// contacts, in one BatchUpdate. Finding where the target landed takes one
+// more call.
+func (c *Client) formatBatch(ctx context.Context, spreadsheetId string, config conf.GenerationConfig, count int) error {
+	target, err := c.findTarget(ctx, spreadsheetId, config.TargetRange)
+	if err != nil {
+		return err
+	}
+	if config.FreezeHeader && target.StartRowIndex == 0 {
+		return fmt.Errorf("freeze-header: %s starts at the top, so there's no header row above it to freeze", config.TargetRange)
+	}
+	log.Printf("Formatting batch of %d in %s", count, config.TargetRange)
+	_, err = c.sheets.Spreadsheets.BatchUpdate(spreadsheetId, &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: formattingRequests(config, target, count),
+	}).Context(ctx).Do()
+	return err
+}
+
+// Works out the sheet and top left cell of the target, which is a tab and
+// cell or a named range
+func (c *Client) findTarget(ctx context.Context, spreadsheetId string, targetRange string) (*sheets.GridRange, error) {
+	spreadsheet, err := c.sheets.Spreadsheets.Get(spreadsheetId).Fields("sheets.properties(sheetId,title)", "namedRanges(name,range)").Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(targetRange, "!") {
+		for _, named := range spreadsheet.NamedRanges {
+			if named.Name == targetRange {
+				return &sheets.GridRange{SheetId: named.Range.SheetId, StartRowIndex: named.Range.StartRowIndex, StartColumnIndex: named.Range.StartColumnIndex}, nil
+			}
+		}
+		return nil, fmt.Errorf("no named range %q in the batch", targetRange)
+	}
+	a1, err := conf.ParseA1Range(targetRange)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range spreadsheet.Sheets {
+		if s.Properties.Title == a1.Sheet {
+			return &sheets.GridRange{SheetId: s.Properties.SheetId, StartRowIndex: int64(max(a1.StartRow-1, 0)), StartColumnIndex: int64(max(a1.StartCol-1, 0))}, nil
+		}
+	}
+	return nil, fmt.Errorf("no tab %q in the batch", a1.Sheet)
+}
+
+// The requests formatBatch sends, for count contacts written from target on
+func formattingRequests(config conf.GenerationConfig, target *sheets.GridRange, count int) []*sheets.Request {
+	// One column of the batch's rows, i columns along from the target
+	column := func(i int) *sheets.GridRange {
+		return &sheets.GridRange{
+			SheetId:          target.SheetId,
+			StartRowIndex:    target.StartRowIndex,
+			EndRowIndex:      target.StartRowIndex + int64(count),
+			StartColumnIndex: target.StartColumnIndex + int64(i),
+			EndColumnIndex:   target.StartColumnIndex + int64(i) + 1,
+		}
+	}
+
+	var requests []*sheets.Request
+	for i, col := range config.Columns {
+		switch col {
+		case conf.ColumnStatus:
+			values := make([]*sheets.ConditionValue, len(conf.StatusValues))
+			for j, status := range conf.StatusValues {
+				values[j] = &sheets.ConditionValue{UserEnteredValue: status}
+			}
+			requests = append(requests, &sheets.Request{
+				SetDataValidation: &sheets.SetDataValidationRequest{
+					Range: column(i),
+					Rule: &sheets.DataValidationRule{
+						Condition:    &sheets.BooleanCondition{Type: "ONE_OF_LIST", Values: values},
+						ShowCustomUi: true,
+						Strict:       true,
+					},
+				},
+			})
+			for _, status := range conf.StatusValues {
+				color, ok := statusColors[status]
+				if !ok {
+					continue
+				}
+				requests = append(requests, &sheets.Request{
+					AddConditionalFormatRule: &sheets.AddConditionalFormatRuleRequest{
+						Rule: &sheets.ConditionalFormatRule{
+							Ranges: []*sheets.GridRange{column(i)},
+							BooleanRule: &sheets.BooleanRule{
+								Condition: &sheets.BooleanCondition{
+									Type:   "TEXT_EQ",
+									Values: []*sheets.ConditionValue{{UserEnteredValue: status}},
+								},
+								Format: &sheets.CellFormat{BackgroundColor: color},
+							},
+						},
+					},
+				})
+			}
+		case conf.ColumnName, conf.ColumnPhone:
+			if !config.ProtectContacts {
+				continue
+			}
+			// Warning only: volunteers can still fix a typo, they just get asked first
+			requests = append(requests, &sheets.Request{
+				AddProtectedRange: &sheets.AddProtectedRangeRequest{
+					ProtectedRange: &sheets.ProtectedRange{
+						Range:       column(i),
+						Description: "Contacts from turnout generate",
+						WarningOnly: true,
+					},
+				},
+			})
+		}
+	}
+	if config.FreezeHeader && target.StartRowIndex > 0 {
+		requests = append(requests, &sheets.Request{
+			UpdateSheetProperties: &sheets.UpdateSheetPropertiesRequest{
+				Fields: "gridProperties.frozenRowCount",
+				Properties: &sheets.SheetProperties{
+					SheetId:        target.SheetId,
+					GridProperties: &sheets.GridProperties{FrozenRowCount: target.StartRowIndex},
+				},
+			},
+		})
+	}
+	return requests
+}
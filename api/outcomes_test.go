@@ -0,0 +1,60 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"go-ogle-sheets/conf"
+	"google.golang.org/api/sheets/v4"
+)
+
+func TestFormattingRequests(t *testing.T) {
+	config := testGenerationConfig()
+	config.Columns = []string{conf.ColumnName, conf.ColumnPhone, conf.ColumnSkip, conf.ColumnStatus}
+	config.FreezeHeader = true
+	config.ProtectContacts = true
+	target := &sheets.GridRange{SheetId: 7, StartRowIndex: 3, StartColumnIndex: 1}
+	requests := formattingRequests(config, target, 10)
+
+	var validation *sheets.SetDataValidationRequest
+	var rules, protected int
+	var frozen int64
+	for _, r := range requests {
+		switch {
+		case r.SetDataValidation != nil:
+			validation = r.SetDataValidation
+		case r.AddConditionalFormatRule != nil:
+			rules++
+		case r.AddProtectedRange != nil:
+			protected++
+			if !r.AddProtectedRange.ProtectedRange.WarningOnly {
+				t.Fatalf("Expected contacts to be protected with a warning only")
+			}
+		case r.UpdateSheetProperties != nil:
+			frozen = r.UpdateSheetProperties.Properties.GridProperties.FrozenRowCount
+		}
+	}
+	if validation == nil {
+		t.Fatalf("Expected a dropdown on the status column")
+	}
+	expected := sheets.GridRange{SheetId: 7, StartRowIndex: 3, EndRowIndex: 13, StartColumnIndex: 4, EndColumnIndex: 5}
+	if !reflect.DeepEqual(*validation.Range, expected) {
+		t.Fatalf("Wrong status range; expected %+v, got %+v", expected, *validation.Range)
+	}
+	if len(validation.Rule.Condition.Values) != len(conf.StatusValues) {
+		t.Fatalf("Wrong dropdown; expected %v, got %d values", conf.StatusValues, len(validation.Rule.Condition.Values))
+	}
+	if rules != len(statusColors) {
+		t.Fatalf("Wrong number of color rules; expected %d, got %d", len(statusColors), rules)
+	}
+	if protected != 2 {
+		t.Fatalf("Wrong number of protected columns; expected 2, got %d", protected)
+	}
+	if frozen != 3 {
+		t.Fatalf("Wrong frozen rows; expected 3, got %d", frozen)
+	}
+
+	if requests := formattingRequests(testGenerationConfig(), target, 10); len(requests) != 0 {
+		t.Fatalf("Expected nothing to do without a status column, freezing or protection, got %d requests", len(requests))
+	}
+}
@@ -0,0 +1,357 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/mail"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go-ogle-sheets/conf"
+	"go-ogle-sheets/util"
+)
+
+// Version is stamped on every spreadsheet generate makes. Set it at build time
+// with -ldflags "-X go-ogle-sheets/api.Version=v1.2.3".
+var Version = "dev"
+
+// ManagedProperty is the appProperty that marks a spreadsheet as ours.
+const ManagedProperty = "turnoutManaged"
+
+// Plan is everything generate is going to do, worked out before any
+// spreadsheet is created. Dry runs print it; real runs execute it.
+type Plan struct {
+	RunId      string          `json:"runId"`
+	Date       string          `json:"date"`
+	EventDate  time.Time       `json:"eventDate"`
+	SourceRows int             `json:"sourceRows"`
+	Selected   int             `json:"selected"`
+	Rejected   []RejectedRow   `json:"rejected"`
+	Batches    []*PlannedBatch `json:"batches"`
+}
+
+// RejectedRow is a source row that won't end up in any batch, and why.
+type RejectedRow struct {
+	Row    int    `json:"row"` // Row number as shown in the source sheet, or 0 if unknown
+	Reason string `json:"reason"`
+}
+
+type PlannedBatch struct {
+	Group     int           `json:"group"`
+	GroupKey  string        `json:"groupKey,omitempty"`
+	Title     string        `json:"title"`
+	Count     int           `json:"count"`
+	Volunteer string        `json:"volunteer,omitempty"`
+	ShareWith []string      `json:"shareWith,omitempty"`
+	Names     []interface{} `json:"-"`
+	Numbers   []interface{} `json:"-"`
+	Messages  []interface{} `json:"-"` // Rendered --message-template per contact, if there is one
+}
+
+// Columns lays the batch out for writing, one slice per output column in
+// the order given. Skipped columns are empty, which Sheets leaves untouched.
+// Phone numbers become tel: or sms: links if phoneLinks asks for them.
+func (b *PlannedBatch) Columns(columns []string, phoneLinks string) [][]interface{} {
+	values := make([][]interface{}, len(columns))
+	for i, col := range columns {
+		switch col {
+		case conf.ColumnName:
+			values[i] = b.Names
+		case conf.ColumnPhone:
+			values[i] = make([]interface{}, len(b.Numbers))
+			for j, number := range b.Numbers {
+				values[i][j] = phoneCell(number, phoneLinks, b.message(j))
+			}
+		case conf.ColumnMessage:
+			values[i] = b.Messages
+		case conf.ColumnStatus:
+			values[i] = make([]interface{}, len(b.Names))
+			for j := range values[i] {
+				values[i][j] = conf.StatusValues[0]
+			}
+		default:
+			values[i] = []interface{}{}
+		}
+	}
+	return values
+}
+
+// The message for the i'th contact, or "" without a message template
+func (b *PlannedBatch) message(i int) string {
+	if i >= len(b.Messages) {
+		return ""
+	}
+	return fmt.Sprint(b.Messages[i])
+}
+
+// BuildPlan picks contacts out of the source rows, shuffles them, splits them
+// into batches and works out titles, volunteers and sharing for each.
+func BuildPlan(config conf.GenerationConfig, rows [][]interface{}) (*Plan, error) {
+	plan := &Plan{RunId: newRunId(), Date: config.Date, EventDate: config.EventDate, SourceRows: len(rows)}
+
+	// Row numbers are only knowable if the read range says where it starts
+	firstRow := 0
+	if readRange, err := conf.ParseA1Range(config.TurnoutReadRange); err == nil && readRange.StartRow > 0 {
+		firstRow = readRange.StartRow
+	}
+	minWidth := max(config.DoTurnoutIdx, config.FirstNameIdx, config.PhoneIdx, config.GroupIdx) + 1
+
+	names := make([]interface{}, 0, len(rows))
+	numbers := make([]interface{}, 0, len(rows))
+	contacts := make([]interface{}, 0, len(rows)) // Whole rows, for message templates
+	for i, row := range rows {
+		rowNum := 0
+		if firstRow > 0 {
+			rowNum = firstRow + i
+		}
+		reason := ""
+		switch {
+		case len(row) < minWidth:
+			reason = fmt.Sprintf("only %d of %d columns filled in", len(row), minWidth)
+		case row[config.DoTurnoutIdx] != "TRUE":
+			reason = fmt.Sprintf("do-turnout is %q, not TRUE", row[config.DoTurnoutIdx])
+		case strings.TrimSpace(fmt.Sprint(row[config.FirstNameIdx])) == "":
+			reason = "no first name"
+		case strings.TrimSpace(fmt.Sprint(row[config.PhoneIdx])) == "":
+			reason = "no phone number"
+		}
+		if reason != "" {
+			plan.Rejected = append(plan.Rejected, RejectedRow{Row: rowNum, Reason: reason})
+			continue
+		}
+		names = append(names, row[config.FirstNameIdx])
+		numbers = append(numbers, row[config.PhoneIdx])
+		contacts = append(contacts, row)
+	}
+	plan.Selected = len(names)
+	if plan.Selected == 0 {
+		return plan, nil
+	}
+
+	// Randomize names & numbers
+	randomized := util.ShuffleSlices([][]interface{}{names, numbers, contacts})
+	names = randomized[0]
+	numbers = randomized[1]
+	contacts = randomized[2]
+
+	titleTemplate, err := conf.ParseTitleTemplate(config.TitleTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("bad title template: %w", err)
+	}
+	volunteers, err := parseVolunteers(config.Volunteers)
+	if err != nil {
+		return nil, err
+	}
+	var messageTemplate *conf.MessageTemplate
+	if config.MessageTemplate != "" {
+		if messageTemplate, err = conf.ParseMessageTemplate(config.MessageTemplate); err != nil {
+			return nil, fmt.Errorf("bad message template: %w", err)
+		}
+	}
+
+	// Each group key is batched on its own, so no batch mixes two of them
+	var spans []contactSpan
+	if config.GroupIdx != conf.NoGroupIdx {
+		groupKeys := make([]string, len(contacts))
+		for i, c := range contacts {
+			groupKeys[i] = strings.TrimSpace(fmt.Sprint(c.([]interface{})[config.GroupIdx]))
+		}
+		var groups []contactSpan
+		names, numbers, contacts, groups = groupContacts(groupKeys, names, numbers, contacts)
+		for _, g := range groups {
+			spans = append(spans, batchSpans(g, config.BatchSize, config.LastPageFudgeFactor)...)
+		}
+	} else {
+		spans = batchSpans(contactSpan{Count: len(names)}, config.BatchSize, config.LastPageFudgeFactor)
+	}
+
+	batches := len(spans)
+	for i, span := range spans {
+		offset, count := span.Offset, span.Count
+		batch := &PlannedBatch{
+			Group:    i + 1,
+			GroupKey: span.Key,
+			Count:    count,
+			Names:    names[offset : offset+count],
+			Numbers:  numbers[offset : offset+count],
+		}
+		// Volunteers take batches round-robin
+		volunteerName := ""
+		if len(volunteers) > 0 {
+			v := volunteers[i%len(volunteers)]
+			batch.Volunteer = v.String()
+			batch.ShareWith = append(batch.ShareWith, v.Address)
+			volunteerName = v.Name
+		}
+		for _, email := range config.ShareWith {
+			if !containsString(batch.ShareWith, email) {
+				batch.ShareWith = append(batch.ShareWith, email)
+			}
+		}
+		batch.Title, err = titleTemplate.Render(conf.TitleData{
+			Date:      config.Date,
+			Group:     batch.Group,
+			Volunteer: volunteerName,
+			GroupKey:  span.Key,
+			Count:     count,
+			Total:     batches,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to render title for group %d: %w", batch.Group, err)
+		}
+		if messageTemplate != nil {
+			batch.Messages = make([]interface{}, count)
+			for j := range count {
+				batch.Messages[j], err = messageTemplate.Render(conf.MessageData{
+					FirstName: fmt.Sprint(batch.Names[j]),
+					Phone:     fmt.Sprint(batch.Numbers[j]),
+					Row:       rowStrings(contacts[offset+j].([]interface{})),
+					Date:      config.Date,
+					EventDate: config.EventDate,
+					Volunteer: volunteerName,
+					Group:     batch.Group,
+					GroupKey:  span.Key,
+				})
+				if err != nil {
+					return nil, fmt.Errorf("failed to render message for %v in group %d: %w", batch.Names[j], batch.Group, err)
+				}
+			}
+		}
+		plan.Batches = append(plan.Batches, batch)
+	}
+	return plan, nil
+}
+
+func rowStrings(row []interface{}) []string {
+	cells := make([]string, len(row))
+	for i, cell := range row {
+		cells[i] = fmt.Sprint(cell)
+	}
+	return cells
+}
+
+// A run of contacts that go in one batch, or (from groupContacts) share a
+// group key
+type contactSpan struct {
+	Key    string
+	Offset int
+	Count  int
+}
+
+// Splits a span into batches the same way an ungrouped run is split
+func batchSpans(span contactSpan, batchSize int, lastPageFudgeFactor int) []contactSpan {
+	batches := calculateBatches(span.Count, batchSize, lastPageFudgeFactor)
+	spans := make([]contactSpan, batches)
+	for i := range batches {
+		offset, count := batchBounds(span.Count, i, batchSize, i >= batches-1, lastPageFudgeFactor)
+		spans[i] = contactSpan{Key: span.Key, Offset: span.Offset + offset, Count: count}
+	}
+	return spans
+}
+
+// Reorders the contacts so each group key's are together, keys in sorted
+// order and contacts in the order they were in (i.e. still shuffled)
+func groupContacts(keys []string, names []interface{}, numbers []interface{}, contacts []interface{}) ([]interface{}, []interface{}, []interface{}, []contactSpan) {
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return keys[order[a]] < keys[order[b]]
+	})
+	var groups []contactSpan
+	grouped := [][]interface{}{make([]interface{}, len(order)), make([]interface{}, len(order)), make([]interface{}, len(order))}
+	for i, j := range order {
+		grouped[0][i], grouped[1][i], grouped[2][i] = names[j], numbers[j], contacts[j]
+		key := keys[j]
+		if len(groups) == 0 || groups[len(groups)-1].Key != key {
+			groups = append(groups, contactSpan{Key: key, Offset: i})
+		}
+		groups[len(groups)-1].Count++
+	}
+	return grouped[0], grouped[1], grouped[2], groups
+}
+
+// Random, and only used to tell runs apart
+func newRunId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Provenance is the set of Drive appProperties generate stamps on a batch's
+// spreadsheet. appProperties are only visible to this OAuth client, so
+// nobody else can forge or accidentally copy them.
+func (p *Plan) Provenance(batch *PlannedBatch) map[string]string {
+	return map[string]string{
+		ManagedProperty:  "true",
+		"turnoutRunId":   p.RunId,
+		"turnoutVersion": Version,
+		"turnoutDate":    p.Date,
+		"turnoutGroup":   strconv.Itoa(batch.Group),
+	}
+}
+
+// Volunteers are "Name <email>" or a bare email, in which case the part before
+// the @ stands in for a name in titles
+func parseVolunteers(specs []string) ([]*mail.Address, error) {
+	volunteers := make([]*mail.Address, len(specs))
+	for i, spec := range specs {
+		addr, err := mail.ParseAddress(spec)
+		if err != nil {
+			return nil, fmt.Errorf("bad volunteer %q: %w", spec, err)
+		}
+		if addr.Name == "" {
+			addr.Name, _, _ = strings.Cut(addr.Address, "@")
+		}
+		volunteers[i] = addr
+	}
+	return volunteers, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteTable prints the plan for humans.
+func (p *Plan) WriteTable(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Run:\t%s\n", p.RunId)
+	fmt.Fprintf(w, "Date:\t%s (%s)\n", p.Date, p.EventDate.Format("Monday, January 2, 2006"))
+	fmt.Fprintf(w, "Source rows:\t%d\n", p.SourceRows)
+	fmt.Fprintf(w, "Selected contacts:\t%d\n", p.Selected)
+	fmt.Fprintf(w, "Rejected rows:\t%d\n", len(p.Rejected))
+	fmt.Fprintf(w, "Batches:\t%d\n\n", len(p.Batches))
+
+	if len(p.Batches) > 0 {
+		fmt.Fprintln(w, "GROUP\tTITLE\tCONTACTS\tVOLUNTEER\tSHARE WITH")
+		for _, b := range p.Batches {
+			fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\n", b.Group, b.Title, b.Count, b.Volunteer, strings.Join(b.ShareWith, ", "))
+		}
+		fmt.Fprintln(w)
+	}
+	if len(p.Batches) > 0 && len(p.Batches[0].Messages) > 0 {
+		fmt.Fprintf(w, "Sample message:\t%s\n\n", p.Batches[0].Messages[0])
+	}
+	if len(p.Rejected) > 0 {
+		fmt.Fprintln(w, "ROW\tREJECTED BECAUSE")
+		for _, r := range p.Rejected {
+			row := "?"
+			if r.Row > 0 {
+				row = fmt.Sprint(r.Row)
+			}
+			fmt.Fprintf(w, "%s\t%s\n", row, r.Reason)
+		}
+	}
+	return w.Flush()
+}
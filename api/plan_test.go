@@ -0,0 +1,206 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"go-ogle-sheets/conf"
+)
+
+func testGenerationConfig() conf.GenerationConfig {
+	return conf.GenerationConfig{
+		Date:                "1/5",
+		TurnoutReadRange:    "turnout-list!B2:E",
+		DoTurnoutIdx:        0,
+		FirstNameIdx:        1,
+		PhoneIdx:            3,
+		GroupIdx:            conf.NoGroupIdx,
+		BatchSize:           10,
+		LastPageFudgeFactor: 3,
+		TitleTemplate:       conf.DefaultTitleTemplate,
+	}
+}
+
+func sourceRows(n int) [][]interface{} {
+	rows := make([][]interface{}, n)
+	for i := range n {
+		rows[i] = []interface{}{"TRUE", "Name", "Last", "555-0100"}
+	}
+	return rows
+}
+
+type batchSizesTestConf struct {
+	contacts int
+	expected []int
+}
+
+var batchSizesTests = []batchSizesTestConf{
+	{0, nil},
+	{2, []int{2}},
+	{7, []int{7}},
+	{10, []int{10}},
+	{13, []int{13}},
+	{14, []int{10, 4}},
+	{33, []int{10, 10, 13}},
+}
+
+func TestBuildPlanBatchSizes(t *testing.T) {
+	for _, test := range batchSizesTests {
+		plan, err := BuildPlan(testGenerationConfig(), sourceRows(test.contacts))
+		if err != nil {
+			t.Fatalf("Unexpected error planning %d contacts: %v", test.contacts, err)
+		}
+		if len(plan.Batches) != len(test.expected) {
+			t.Fatalf("Wrong number of batches for %d contacts; expected %d, got %d", test.contacts, len(test.expected), len(plan.Batches))
+		}
+		total := 0
+		for i, b := range plan.Batches {
+			if b.Count != test.expected[i] || len(b.Names) != b.Count || len(b.Numbers) != b.Count {
+				t.Fatalf("Wrong size for batch %d of %d contacts; expected %d, got %d (%d names, %d numbers)", i, test.contacts, test.expected[i], b.Count, len(b.Names), len(b.Numbers))
+			}
+			total += b.Count
+		}
+		if total != test.contacts {
+			t.Fatalf("Lost contacts; expected %d across batches, got %d", test.contacts, total)
+		}
+	}
+}
+
+func TestBuildPlanRejections(t *testing.T) {
+	rows := [][]interface{}{
+		{"TRUE", "Ana", "A", "555-0101"},
+		{"FALSE", "Ben", "B", "555-0102"},
+		{"TRUE", "Cat"},
+		{"TRUE", "", "C", "555-0103"},
+		{"TRUE", "Dee", "D", " "},
+		{"TRUE", "Eve", "E", "555-0104"},
+	}
+	plan, err := BuildPlan(testGenerationConfig(), rows)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if plan.Selected != 2 {
+		t.Fatalf("Wrong number selected; expected 2, got %d", plan.Selected)
+	}
+	expectedRows := []int{3, 4, 5, 6}
+	if len(plan.Rejected) != len(expectedRows) {
+		t.Fatalf("Wrong rejections; expected rows %v, got %+v", expectedRows, plan.Rejected)
+	}
+	for i, r := range plan.Rejected {
+		if r.Row != expectedRows[i] || r.Reason == "" {
+			t.Fatalf("Wrong rejection %d; expected row %d with a reason, got %+v", i, expectedRows[i], r)
+		}
+	}
+}
+
+func TestBuildPlanVolunteers(t *testing.T) {
+	config := testGenerationConfig()
+	config.TitleTemplate = "{{.Volunteer}} - {{.Date}} - Group {{.Group}}"
+	config.Volunteers = []string{"Sam Smith <sam@example.org>", "jo@example.org"}
+	config.ShareWith = []string{"lead@example.org", "jo@example.org"}
+	plan, err := BuildPlan(config, sourceRows(30))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedTitles := []string{"Sam Smith - 1/5 - Group 1", "jo - 1/5 - Group 2", "Sam Smith - 1/5 - Group 3"}
+	expectedShares := [][]string{
+		{"sam@example.org", "lead@example.org", "jo@example.org"},
+		{"jo@example.org", "lead@example.org"},
+		{"sam@example.org", "lead@example.org", "jo@example.org"},
+	}
+	for i, b := range plan.Batches {
+		if b.Title != expectedTitles[i] {
+			t.Fatalf("Wrong title for batch %d; expected %q, got %q", i, expectedTitles[i], b.Title)
+		}
+		if len(b.ShareWith) != len(expectedShares[i]) {
+			t.Fatalf("Wrong sharing for batch %d; expected %v, got %v", i, expectedShares[i], b.ShareWith)
+		}
+		for j := range b.ShareWith {
+			if b.ShareWith[j] != expectedShares[i][j] {
+				t.Fatalf("Wrong sharing for batch %d; expected %v, got %v", i, expectedShares[i], b.ShareWith)
+			}
+		}
+	}
+}
+
+func TestPlannedBatchColumns(t *testing.T) {
+	batch := &PlannedBatch{Names: []interface{}{"Sam", "Jo"}, Numbers: []interface{}{"555-0100", "555-0101"}}
+	values := batch.Columns([]string{conf.ColumnPhone, conf.ColumnSkip, conf.ColumnName}, conf.PhoneLinksNone)
+	if len(values) != 3 {
+		t.Fatalf("Wrong number of columns; expected %v, got %v", 3, len(values))
+	}
+	if values[0][0] != "555-0100" || len(values[1]) != 0 || values[2][1] != "Jo" {
+		t.Fatalf("Wrong column layout; expected phone, skip, name, got %v", values)
+	}
+}
+
+func TestBuildPlanMessages(t *testing.T) {
+	config := testGenerationConfig()
+	config.Volunteers = []string{"Jo <jo@example.org>"}
+	config.MessageTemplate = "Hi {{.FirstName}} {{index .Row 2}}, it's {{.Volunteer}}. See you {{.Date}}?\n"
+	rows := [][]interface{}{
+		{"TRUE", "Ana", "A", "555-0101"},
+		{"TRUE", "Ben", "B", "555-0102"},
+	}
+	plan, err := BuildPlan(config, rows)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	batch := plan.Batches[0]
+	for i, name := range batch.Names {
+		expected := map[interface{}]string{
+			"Ana": "Hi Ana A, it's Jo. See you 1/5?",
+			"Ben": "Hi Ben B, it's Jo. See you 1/5?",
+		}[name]
+		if batch.Messages[i] != expected {
+			t.Fatalf("Wrong message for %v; expected %q, got %q", name, expected, batch.Messages[i])
+		}
+	}
+	values := batch.Columns([]string{conf.ColumnMessage}, conf.PhoneLinksNone)
+	if len(values[0]) != 2 || values[0][0] != batch.Messages[0] {
+		t.Fatalf("Wrong message column; expected %v, got %v", batch.Messages, values[0])
+	}
+
+	config.MessageTemplate = "Hi {{index .Row 9}}"
+	if _, err := BuildPlan(config, rows); err == nil {
+		t.Fatalf("Expected an error for a template reading past the end of the row")
+	}
+}
+
+func TestBuildPlanGroups(t *testing.T) {
+	config := testGenerationConfig()
+	config.GroupIdx = 2
+	config.BatchSize = 2
+	config.LastPageFudgeFactor = 0
+	config.TitleTemplate = "{{.GroupKey}} - {{.Date}} - Group {{.Group}}"
+	var rows [][]interface{}
+	for i := range 5 {
+		rows = append(rows, []interface{}{"TRUE", fmt.Sprintf("North %d", i), "North", "555-0100"})
+	}
+	for i := range 2 {
+		rows = append(rows, []interface{}{"TRUE", fmt.Sprintf("South %d", i), " South ", "555-0100"})
+	}
+	plan, err := BuildPlan(config, rows)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectedKeys := []string{"North", "North", "North", "South"}
+	expectedCounts := []int{2, 2, 1, 2}
+	if len(plan.Batches) != len(expectedKeys) {
+		t.Fatalf("Wrong number of batches; expected %d, got %d", len(expectedKeys), len(plan.Batches))
+	}
+	for i, b := range plan.Batches {
+		if b.GroupKey != expectedKeys[i] || b.Count != expectedCounts[i] {
+			t.Fatalf("Wrong batch %d; expected %d of %s, got %d of %s", i, expectedCounts[i], expectedKeys[i], b.Count, b.GroupKey)
+		}
+		if expectedTitle := fmt.Sprintf("%s - 1/5 - Group %d", expectedKeys[i], i+1); b.Title != expectedTitle {
+			t.Fatalf("Wrong title for batch %d; expected %q, got %q", i, expectedTitle, b.Title)
+		}
+		for _, name := range b.Names {
+			if !strings.HasPrefix(name.(string), b.GroupKey) {
+				t.Fatalf("Batch %d for %s got %v from another group", i, b.GroupKey, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"strings"
+	"time"
+)
+
+const spreadsheetMimeType = "application/vnd.google-apps.spreadsheet"
+
+// Query builds a Drive v3 search query (the q parameter). Every value is
+// quoted and escaped, so user input can only ever be a value and never change
+// the shape of the query. Clauses are joined with and.
+type Query struct {
+	clauses []string
+}
+
+func NewQuery() *Query {
+	return &Query{}
+}
+
+// QuoteString makes s safe to use as a string literal in a Drive query.
+func QuoteString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+func (q *Query) add(clause string) *Query {
+	q.clauses = append(q.clauses, clause)
+	return q
+}
+
+func (q *Query) NameContains(s string) *Query {
+	return q.add("name contains " + QuoteString(s))
+}
+
+func (q *Query) NameEquals(s string) *Query {
+	return q.add("name = " + QuoteString(s))
+}
+
+func (q *Query) MimeType(mimeType string) *Query {
+	return q.add("mimeType = " + QuoteString(mimeType))
+}
+
+// InParents matches files in any of the given folders.
+func (q *Query) InParents(folderIds ...string) *Query {
+	if len(folderIds) == 0 {
+		return q
+	}
+	ors := make([]string, len(folderIds))
+	for i, id := range folderIds {
+		ors[i] = QuoteString(id) + " in parents"
+	}
+	return q.add("(" + strings.Join(ors, " or ") + ")")
+}
+
+func (q *Query) CreatedAfter(t time.Time) *Query {
+	return q.add("createdTime >= " + QuoteString(t.UTC().Format(time.RFC3339)))
+}
+
+func (q *Query) CreatedBefore(t time.Time) *Query {
+	return q.add("createdTime < " + QuoteString(t.UTC().Format(time.RFC3339)))
+}
+
+func (q *Query) OwnedBy(email string) *Query {
+	return q.add(QuoteString(email) + " in owners")
+}
+
+// AppProperty matches files with the given private app property, which only
+// this OAuth client can set or see.
+func (q *Query) AppProperty(key string, value string) *Query {
+	return q.add("appProperties has { key=" + QuoteString(key) + " and value=" + QuoteString(value) + " }")
+}
+
+func (q *Query) Trashed(trashed bool) *Query {
+	if trashed {
+		return q.add("trashed = true")
+	}
+	return q.add("trashed = false")
+}
+
+// Raw adds a hand-written clause, like the one from clean --q. It's wrapped in
+// parentheses so an "or" inside can't escape the other clauses, which only
+// holds if the clause's own parentheses balance; CleanConfig.Validate checks.
+func (q *Query) Raw(clause string) *Query {
+	return q.add("(" + clause + ")")
+}
+
+// Clone returns a copy of q to add more clauses to without changing q.
+func (q *Query) Clone() *Query {
+	return &Query{clauses: append([]string(nil), q.clauses...)}
+}
+
+func (q *Query) String() string {
+	return strings.Join(q.clauses, " and ")
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+type queryTestConf struct {
+	given    *Query
+	expected string
+}
+
+var queryTests = []queryTestConf{
+	{
+		NewQuery().NameContains("IC Turnout - 1/5").Trashed(false),
+		`name contains 'IC Turnout - 1/5' and trashed = false`,
+	},
+	{
+		NewQuery().NameContains("Bob's list"),
+		`name contains 'Bob\'s list'`,
+	},
+	{
+		// Someone trying to widen the search just gets a weird name
+		NewQuery().NameContains("x' or name contains '").MimeType(spreadsheetMimeType),
+		`name contains 'x\' or name contains \'' and mimeType = 'application/vnd.google-apps.spreadsheet'`,
+	},
+	{
+		NewQuery().NameEquals(`back\slash`),
+		`name = 'back\\slash'`,
+	},
+	{
+		NewQuery().InParents("folderA", "folderB").OwnedBy("me@example.org"),
+		`('folderA' in parents or 'folderB' in parents) and 'me@example.org' in owners`,
+	},
+	{
+		NewQuery().CreatedAfter(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)).CreatedBefore(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)),
+		`createdTime >= '2025-01-01T00:00:00Z' and createdTime < '2025-02-01T00:00:00Z'`,
+	},
+	{
+		NewQuery().Raw("name contains 'a' or name contains 'b'").Trashed(true),
+		`(name contains 'a' or name contains 'b') and trashed = true`,
+	},
+	{
+		NewQuery().AppProperty("turnoutManaged", "true"),
+		`appProperties has { key='turnoutManaged' and value='true' }`,
+	},
+	{
+		NewQuery().InParents(),
+		``,
+	},
+}
+
+func TestQuery(t *testing.T) {
+	for _, test := range queryTests {
+		if actual := test.given.String(); actual != test.expected {
+			t.Fatalf("Wrong query; expected %s, got %s", test.expected, actual)
+		}
+	}
+}
+
+func TestQueryClone(t *testing.T) {
+	base := NewQuery().Trashed(false)
+	extended := base.Clone().NameContains("a")
+	if base.String() != "trashed = false" {
+		t.Fatalf("Clone changed the original query: %s", base.String())
+	}
+	if extended.String() != "trashed = false and name contains 'a'" {
+		t.Fatalf("Wrong cloned query: %s", extended.String())
+	}
+}
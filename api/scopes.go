@@ -0,0 +1,94 @@
+package api
+
+import (
+	"slices"
+
+	"go-ogle-sheets/conf"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/sheets/v4"
+)
+
+// We used to ask for all of Drive, which lets us read and delete anything the
+// user has. Now each command asks for the least it needs:
+//
+//   - drive.file only covers files turnout itself created (or was handed), which
+//     is exactly what clean and restore go looking for
+//   - spreadsheets reads the source and template sheets, which turnout didn't create
+//   - dry runs only read, so they get read-only scopes
+//
+// Anything broader is asked for on top of what's already granted, when it's
+// actually needed (see userTokenSource).
+
+// SourceScopes is what reading the source needs, which is all a dry run does.
+var SourceScopes = []string{sheets.SpreadsheetsReadonlyScope}
+
+// GenerateScopes is what creating batches needs. Copying a whole template
+// spreadsheet turnout didn't make means reading it through Drive, which
+// drive.file can't do.
+func GenerateScopes(config conf.GenerationConfig) []string {
+	scopes := []string{drive.DriveFileScope, sheets.SpreadsheetsScope}
+	if config.TemplateSpreadsheetId != "" {
+		scopes = append(scopes, drive.DriveReadonlyScope)
+	}
+	return scopes
+}
+
+// CleanScopes is what clean (and restore) need. Files turnout didn't create
+// are invisible under drive.file, so --include-unmanaged needs all of Drive.
+func CleanScopes(config conf.CleanConfig) []string {
+	var scopes []string
+	switch {
+	case config.IncludeUnmanaged && config.Test:
+		scopes = []string{drive.DriveMetadataReadonlyScope}
+	case config.IncludeUnmanaged:
+		scopes = []string{drive.DriveScope}
+	default:
+		scopes = []string{drive.DriveFileScope}
+	}
+	if config.Archive != "" && !config.Test {
+		// Reading what we archive, and appending to an archive spreadsheet
+		scopes = append(scopes, sheets.SpreadsheetsScope)
+	}
+	return scopes
+}
+
+// LoginScopes is what `auth login` asks for up front: enough to generate and clean.
+var LoginScopes = GenerateScopes(conf.GenerationConfig{})
+
+// Broader scopes that cover narrower ones, so a token with all of Drive doesn't
+// get sent back to the browser for drive.file
+var scopeImplies = map[string][]string{
+	drive.DriveScope: {drive.DriveFileScope, drive.DriveReadonlyScope, drive.DriveMetadataReadonlyScope,
+		sheets.SpreadsheetsScope, sheets.SpreadsheetsReadonlyScope},
+	drive.DriveReadonlyScope: {drive.DriveMetadataReadonlyScope, sheets.SpreadsheetsReadonlyScope},
+	sheets.SpreadsheetsScope: {sheets.SpreadsheetsReadonlyScope},
+}
+
+// missingScopes returns the scopes in wanted that granted doesn't cover.
+func missingScopes(granted, wanted []string) []string {
+	var missing []string
+	for _, w := range wanted {
+		covered := false
+		for _, g := range granted {
+			if g == w || slices.Contains(scopeImplies[g], w) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			missing = append(missing, w)
+		}
+	}
+	return missing
+}
+
+// unionScopes adds extra to scopes, skipping ones already there.
+func unionScopes(scopes []string, extra ...string) []string {
+	union := slices.Clone(scopes)
+	for _, s := range extra {
+		if !slices.Contains(union, s) {
+			union = append(union, s)
+		}
+	}
+	return union
+}
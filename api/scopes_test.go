@@ -0,0 +1,55 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"go-ogle-sheets/conf"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/sheets/v4"
+)
+
+type missingScopesTestConf struct {
+	granted  []string
+	wanted   []string
+	expected []string
+}
+
+var missingScopesTests = []missingScopesTestConf{
+	{[]string{drive.DriveFileScope, sheets.SpreadsheetsScope}, []string{drive.DriveFileScope}, nil},
+	{[]string{sheets.SpreadsheetsScope}, []string{sheets.SpreadsheetsReadonlyScope}, nil},
+	{[]string{drive.DriveScope}, []string{drive.DriveFileScope, sheets.SpreadsheetsScope}, nil},
+	{[]string{drive.DriveFileScope}, []string{drive.DriveScope}, []string{drive.DriveScope}},
+	{[]string{sheets.SpreadsheetsReadonlyScope}, LoginScopes, LoginScopes},
+	{[]string{drive.DriveFileScope, sheets.SpreadsheetsScope}, GenerateScopes(conf.GenerationConfig{TemplateSpreadsheetId: "abc"}), []string{drive.DriveReadonlyScope}},
+	{nil, []string{drive.DriveFileScope}, []string{drive.DriveFileScope}},
+}
+
+func TestMissingScopes(t *testing.T) {
+	for _, test := range missingScopesTests {
+		if actual := missingScopes(test.granted, test.wanted); !reflect.DeepEqual(actual, test.expected) {
+			t.Fatalf("Wrong missing scopes for %v; expected %v, got %v", test.granted, test.expected, actual)
+		}
+	}
+}
+
+type cleanScopesTestConf struct {
+	config   conf.CleanConfig
+	expected []string
+}
+
+var cleanScopesTests = []cleanScopesTestConf{
+	{conf.CleanConfig{}, []string{drive.DriveFileScope}},
+	{conf.CleanConfig{Archive: "out.csv"}, []string{drive.DriveFileScope, sheets.SpreadsheetsScope}},
+	{conf.CleanConfig{Archive: "out.csv", Test: true}, []string{drive.DriveFileScope}},
+	{conf.CleanConfig{IncludeUnmanaged: true}, []string{drive.DriveScope}},
+	{conf.CleanConfig{IncludeUnmanaged: true, Test: true}, []string{drive.DriveMetadataReadonlyScope}},
+}
+
+func TestCleanScopes(t *testing.T) {
+	for _, test := range cleanScopesTests {
+		if actual := CleanScopes(test.config); !reflect.DeepEqual(actual, test.expected) {
+			t.Fatalf("Wrong scopes for %+v; expected %v, got %v", test.config, test.expected, actual)
+		}
+	}
+}
@@ -3,122 +3,304 @@ package api
 import (
 	"context"
 	"log"
-	"os"
 
 	"errors"
 	"fmt"
 	"go-ogle-sheets/conf"
-	"golang.org/x/oauth2/google"
+	"go-ogle-sheets/util"
 	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 	"net/http"
-	"go-ogle-sheets/util"
+	"regexp"
+	"time"
 )
 
-var sheetsService *sheets.Service
-var driveService *drive.Service
+// Verbose turns on extra logging, like how many API calls each batch took.
+var Verbose bool
+
+func verbosef(format string, args ...interface{}) {
+	if Verbose {
+		log.Printf(format, args...)
+	}
+}
+
+// Client talks to Sheets and Drive as one Google account. Commands can hold
+// more than one, e.g. reading the source as one account and creating batches
+// as another.
+type Client struct {
+	Account string // Name from the config's accounts, or "" for the default
+	sheets  *sheets.Service
+	drive   *drive.Service
+}
 
-func GenerateAllBatches(config conf.GenerationConfig) error {
+// GeneratePlan reads the source spreadsheet and works out what generate would
+// do, without creating anything.
+func (c *Client) GeneratePlan(ctx context.Context, config conf.GenerationConfig) (*Plan, error) {
 	log.Printf("Gathering source data...")
-	names, numbers, err := getNamesAndNumbers(config.TurnoutSourceId, config.TurnoutReadRange, config.DoTurnoutIdx, config.FirstNameIdx, config.PhoneIdx)
+	rows, err := c.getSourceRows(ctx, config.TurnoutSourceId, config.TurnoutReadRange)
+	if err != nil {
+		log.Printf("Error in getSourceRows: %v", err)
+		return nil, err
+	}
+	if config.MessageTemplateRange != "" {
+		// Organizers can edit the message without touching anyone's config
+		config.MessageTemplate, err = c.getMessageTemplate(ctx, config.TurnoutSourceId, config.MessageTemplateRange)
+		if err != nil {
+			log.Printf("Error in getMessageTemplate: %v", err)
+			return nil, err
+		}
+	}
+	return BuildPlan(config, rows)
+}
+
+func (c *Client) GenerateAllBatches(ctx context.Context, config conf.GenerationConfig) error {
+	plan, err := c.GeneratePlan(ctx, config)
 	if err != nil {
-		log.Printf("Error in GetNamesAndNumbers: %v", err)
 		return err
 	}
-	// Randomize names & numbers
-	randomized := util.ShuffleSlices([][]interface{}{names, numbers})
-	names = randomized[0]
-	numbers = randomized[1]
+	return c.ExecutePlan(ctx, config, plan)
+}
 
-	batches := calculateBatches(len(names), config.BatchSize, config.LastPageFudgeFactor)
-	titles := make([]string, batches)
+// ExecutePlan creates, fills and shares every batch in the plan.
+func (c *Client) ExecutePlan(ctx context.Context, config conf.GenerationConfig, plan *Plan) error {
+	batches := len(plan.Batches)
 	log.Printf("Generating and filling %d spreadsheets", batches)
 
 	// Concurrently create each batch
-	ch := make(chan error, config.Concurrency)
-	for i := range batches {
-		go func(ch chan error) {
-			titles[i] = SpreadsheetNameFromDate(config.Date, i+1)
-			spreadsheet, err := CreateEmptySpreadsheet(titles[i])
-			if err != nil {
-				log.Printf("Error in CreateEmptySpreadsheet: %v", err)
-			}
-
-			err = copyTemplateIntoSheet(config.TurnoutSourceId, config.TemplateSheetId, spreadsheet)
-			if err != nil {
-				log.Printf("Error in CopyTemplateIntoSheet: %v", err)
-			}
-
-			_, err = insertBatchIntoSheet(names, numbers, spreadsheet.SpreadsheetId, i, config.BatchSize, i >= batches-1, config.LastPageFudgeFactor)
-			if err != nil {
-				log.Printf("Error in InsertBatchIntoSheet: %v", err)
-			}
-			ch<-err
-		}(ch)
-	}
-	errs := make([]error, 0, batches)
-	for i := 0; i < batches; i++ {
-		e := <-ch
-		if e != nil {
-			errs = append(errs, e)
-		}
-		if i >= batches { // TODO: this is clumsy
-			close(ch)
-		}
-	}
+	created := make([]bool, batches)
+	errs := util.RunConcurrently(batches, config.Concurrency, func(i int) error {
+		var err error
+		created[i], err = c.executeBatch(ctx, config, plan, plan.Batches[i])
+		return err
+	})
 	if len(errs) > 0 {
 		log.Printf("Errors while generating spreadsheets: %v", errors.Join(errs...))
 	}
-	fmt.Printf("Successfully generated %d spreadsheets!\n", batches)
+	var titles []string
+	for i, batch := range plan.Batches {
+		if created[i] {
+			titles = append(titles, batch.Title)
+		}
+	}
+	fmt.Printf("Successfully generated %d of %d spreadsheets!\n", len(titles), batches)
 	for i := range titles {
 		fmt.Println(titles[i])
 	}
 	return errors.Join(errs...)
 }
 
-// This is goofy, but I'm just cruising through how go works again
-type DriveFile struct {
-	Name string
-	Id   string
+// How long rolling back a failed batch gets, on top of whatever the batch used
+const rollbackTimeout = 30 * time.Second
+
+// executeBatch makes one batch's spreadsheet, all within config.Timeout. If
+// filling it fails (or times out, or the run is cancelled) the half-made
+// spreadsheet is deleted again, so a rerun doesn't leave duplicates behind.
+// A filled spreadsheet that couldn't be shared is kept, but still an error.
+func (c *Client) executeBatch(ctx context.Context, config conf.GenerationConfig, plan *Plan, batch *PlannedBatch) (created bool, err error) {
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+	// Every API call this batch makes, for --verbose
+	ctx, calls := withCallCounter(ctx)
+	defer func() {
+		verbosef("%s: %d API calls", batch.Title, calls.Load())
+	}()
+
+	// Stamped as it's created so clean can find it even if a later step fails
+	var spreadsheetId string
+	if config.TemplateSpreadsheetId != "" {
+		spreadsheetId, err = c.CopySpreadsheet(ctx, config.TemplateSpreadsheetId, batch.Title, plan.Provenance(batch))
+		if err != nil {
+			log.Printf("Error in CopySpreadsheet: %v", err)
+			return false, err
+		}
+	} else {
+		spreadsheetId, err = c.CreateEmptySpreadsheet(ctx, batch.Title, plan.Provenance(batch))
+		if err != nil {
+			log.Printf("Error in CreateEmptySpreadsheet: %v", err)
+			return false, err
+		}
+		// Validate made sure a tab copy's target isn't a named range
+		target, _ := conf.ParseA1Range(config.TargetRange)
+		err = c.copyTemplateIntoSheet(ctx, config.TurnoutSourceId, config.TemplateSheetId, spreadsheetId, target.Sheet)
+		if err != nil {
+			log.Printf("Error in CopyTemplateIntoSheet: %v", err)
+		}
+	}
+	if err == nil {
+		if _, err = c.insertBatchIntoSheet(ctx, batch, spreadsheetId, config); err != nil {
+			log.Printf("Error in InsertBatchIntoSheet: %v", err)
+		}
+	}
+	if err == nil && needsFormatting(config) {
+		if err = c.formatBatch(ctx, spreadsheetId, config, batch.Count); err != nil {
+			log.Printf("Error in formatBatch: %v", err)
+		}
+	}
+	if err != nil {
+		return false, errors.Join(fmt.Errorf("%s: %w", batch.Title, err), c.rollback(ctx, spreadsheetId))
+	}
+
+	if shareErr := c.shareSpreadsheet(ctx, spreadsheetId, batch.ShareWith); shareErr != nil {
+		log.Printf("Error in shareSpreadsheet: %v", shareErr)
+		return true, fmt.Errorf("%s: %w", batch.Title, shareErr)
+	}
+	return true, nil
+}
+
+// Deletes a half-made spreadsheet. The batch's context may well be what
+// failed, so this gets its own (which still ends if rollback hangs).
+func (c *Client) rollback(ctx context.Context, spreadsheetId string) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+	log.Printf("Rolling back %s", spreadsheetId)
+	if err := c.DeleteSpreadsheet(ctx, spreadsheetId); err != nil {
+		return fmt.Errorf("rolling back %s failed; it's stamped, so clean can find it: %w", spreadsheetId, err)
+	}
+	return nil
+}
+
+// FindSpreadsheets finds what clean (or restore) was asked for: a raw --q, a
+// --match pattern, a --since/--until range or a single --date, any of them
+// limited by --older-than, or just --older-than on its own. base holds
+// clauses every search should have, like whether to look in the trash.
+func (c *Client) FindSpreadsheets(ctx context.Context, base *Query, config conf.CleanConfig) ([]*DriveFile, error) {
+	if !config.Cutoff.IsZero() {
+		base = base.Clone().CreatedBefore(config.Cutoff)
+	}
+	if config.Q != "" {
+		return c.AllSpreadsheetsByQ(ctx, base.Clone().Raw(config.Q))
+	} else if config.MatchPattern != "" {
+		return c.AllSpreadsheetsByPartialName(ctx, base, config.MatchPattern)
+	} else if config.IsRange() {
+		return c.AllSpreadsheetsInDateRange(ctx, base, config)
+	} else if config.Date == "" {
+		return c.AllSpreadsheetsByQ(ctx, base)
+	}
+	return c.AllSpreadsheetsByTitleTemplate(ctx, base, config.TitleTemplate, config.Date)
 }
 
-func AllSpreadsheetsByPartialName(namePart string) ([]*DriveFile, error) {
-	return AllSpreadsheetsByQ(fmt.Sprintf("name contains '%s'", namePart))
+func (c *Client) AllSpreadsheetsByPartialName(ctx context.Context, base *Query, namePart string) ([]*DriveFile, error) {
+	return c.AllSpreadsheetsByQ(ctx, base.Clone().NameContains(namePart))
 }
 
-func AllSpreadsheetsByQ(q string) ([]*DriveFile, error) {
-	endQ := fmt.Sprintf("mimeType = 'application/vnd.google-apps.spreadsheet' and %s", q)
-	fileList, err := driveService.Files.List().Q(endQ).Do()
+// AllSpreadsheetsByTitleTemplate finds the spreadsheets generate would have
+// created for date with the same title template.
+func (c *Client) AllSpreadsheetsByTitleTemplate(ctx context.Context, base *Query, titleTemplate string, date string) ([]*DriveFile, error) {
+	driveFiles, _, err := c.spreadsheetsMatchingTemplate(ctx, base, titleTemplate, date)
+	return driveFiles, err
+}
+
+// AllSpreadsheetsInDateRange finds spreadsheets titled by the template for any
+// date between config's --since and --until, reading the date back out of the
+// title with config's date layout.
+func (c *Client) AllSpreadsheetsInDateRange(ctx context.Context, base *Query, config conf.CleanConfig) ([]*DriveFile, error) {
+	driveFiles, matcher, err := c.spreadsheetsMatchingTemplate(ctx, base, config.TitleTemplate, conf.AnyDate)
 	if err != nil {
-		log.Printf("Error finding spreadsheets by name: %v", err)
 		return nil, err
 	}
-	driveFiles := make([]*DriveFile, len(fileList.Files))
-	for i, f := range fileList.Files {
-		driveFiles[i] = &DriveFile{Name: f.Name, Id: f.Id}
+	// Year-less layouts get the year closest to the end of the range
+	reference := config.UntilDate
+	if reference.IsZero() {
+		reference = time.Now()
+	}
+	dateIdx := matcher.SubexpIndex("date")
+	inRange := make([]*DriveFile, 0, len(driveFiles))
+	for _, f := range driveFiles {
+		m := matcher.FindStringSubmatch(f.Name)
+		if dateIdx < 0 || m == nil {
+			continue
+		}
+		date, err := conf.ParseDateLayout(m[dateIdx], []string{config.DateLayout}, reference)
+		if err != nil {
+			log.Printf("Skipping %s: can't read date %q from title: %v", f.Name, m[dateIdx], err)
+			continue
+		}
+		if config.InRange(date) {
+			inRange = append(inRange, f)
+		}
+	}
+	return inRange, nil
+}
+
+// Searches Drive for every literal piece of the template, then filters with
+// the template's matcher since Drive's contains is looser than we'd like (and
+// ignores order)
+func (c *Client) spreadsheetsMatchingTemplate(ctx context.Context, base *Query, titleTemplate string, date string) ([]*DriveFile, *regexp.Regexp, error) {
+	tmpl, err := conf.ParseTitleTemplate(titleTemplate)
+	if err != nil {
+		return nil, nil, err
 	}
-	return driveFiles, nil
+	fragments, err := tmpl.Fragments(date)
+	if err != nil {
+		return nil, nil, err
+	}
+	matcher, err := tmpl.Matcher(date)
+	if err != nil {
+		return nil, nil, err
+	}
+	q := base.Clone()
+	for _, f := range fragments {
+		q.NameContains(f)
+	}
+	driveFiles, err := c.AllSpreadsheetsByQ(ctx, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	matched := make([]*DriveFile, 0, len(driveFiles))
+	for _, f := range driveFiles {
+		if matcher.MatchString(f.Name) {
+			matched = append(matched, f)
+		}
+	}
+	return matched, matcher, nil
+}
+
+// Gives each address edit access to the spreadsheet
+func (c *Client) shareSpreadsheet(ctx context.Context, spreadsheetId string, emails []string) error {
+	var errs []error
+	for _, email := range emails {
+		log.Printf("Sharing %s with %s", spreadsheetId, email)
+		_, err := c.drive.Permissions.Create(spreadsheetId, &drive.Permission{
+			Type:         "user",
+			Role:         "writer",
+			EmailAddress: email,
+		}).Context(ctx).Do()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sharing with %s: %w", email, err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
-func DeleteSpreadsheet(spreadsheetId string) error {
-	return driveService.Files.Delete(spreadsheetId).Do()
+// DeleteSpreadsheet permanently deletes a spreadsheet, skipping the trash.
+func (c *Client) DeleteSpreadsheet(ctx context.Context, spreadsheetId string) error {
+	return c.drive.Files.Delete(spreadsheetId).Context(ctx).Do()
 }
 
-func SpreadsheetNameFromDate(date string, group int) string {
-	return fmt.Sprintf("%s - Group %d", SpreadsheetNamePrefixFromDate(date), group)
+// TrashSpreadsheet moves a spreadsheet to the trash, where Drive keeps it for
+// 30 days.
+func (c *Client) TrashSpreadsheet(ctx context.Context, spreadsheetId string) error {
+	_, err := c.drive.Files.Update(spreadsheetId, &drive.File{Trashed: true}).Context(ctx).Do()
+	return err
 }
 
-// TODO: Configurable base name
-func SpreadsheetNamePrefixFromDate(date string) string {
-	return fmt.Sprintf("IC Turnout - %s", date)
+// RestoreSpreadsheet takes a spreadsheet back out of the trash.
+func (c *Client) RestoreSpreadsheet(ctx context.Context, spreadsheetId string) error {
+	_, err := c.drive.Files.Update(spreadsheetId, &drive.File{
+		Trashed:         false,
+		ForceSendFields: []string{"Trashed"}, // false would otherwise be left out
+	}).Context(ctx).Do()
+	return err
 }
 
-func insertBatchIntoSheet(names []interface{}, numbers []interface{}, targetSpreadsheetId string, batchIdx int, batchSize int, isLastBatch bool, lastPageFudgeFactor int) (*sheets.UpdateValuesResponse, error) {
-	// Calculate target range
-	n := len(names)
-	offset := (batchIdx) * batchSize // 0, 10, 20, ...
-	batchRows := batchSize
+// Where a batch starts in the full list of n contacts, and how many it gets
+func batchBounds(n int, batchIdx int, batchSize int, isLastBatch bool, lastPageFudgeFactor int) (offset int, batchRows int) {
+	offset = (batchIdx) * batchSize // 0, 10, 20, ...
+	batchRows = batchSize
 	if isLastBatch { // last batch is special
 		if n%batchSize <= lastPageFudgeFactor { // throw the last few in the same batch
 			batchRows = batchSize + n%batchSize
@@ -126,121 +308,136 @@ func insertBatchIntoSheet(names []interface{}, numbers []interface{}, targetSpre
 			batchRows = n % batchSize
 		}
 	}
+	// Fewer contacts than a batch (and within the fudge factor) all go in one
+	return offset, min(batchRows, n-offset)
+}
 
+// Writes the batch starting at config.TargetRange, which is a tab and cell or
+// a named range (Sheets takes either), one column per entry in config.Columns
+func (c *Client) insertBatchIntoSheet(ctx context.Context, batch *PlannedBatch, targetSpreadsheetId string, config conf.GenerationConfig) (*sheets.BatchUpdateValuesResponse, error) {
 	// Create insertValues as slice of columns
-	insertValues := make([][]interface{}, 2)
-	insertValues[0] = names[offset : offset+batchRows]
-	insertValues[1] = numbers[offset : offset+batchRows]
-
-	// Write names and numbers to new sheet
-	log.Printf("Inserting batch of %d into target table", len(insertValues[0]))
-	valueRange := "Sheet1!A2:B"
-	return sheetsService.Spreadsheets.Values.Update(targetSpreadsheetId, valueRange, &sheets.ValueRange{
-		MajorDimension: "COLUMNS",
-		Range:          valueRange,
-		Values:         insertValues,
-	}).ValueInputOption("RAW").Do()
+	insertValues := batch.Columns(config.Columns, config.PhoneLinks)
+	valueRange := config.TargetRange
+
+	// Write names and numbers to new sheet. One values.batchUpdate however many
+	// ranges we end up writing
+	log.Printf("Inserting batch of %d into %s", batch.Count, valueRange)
+	return c.sheets.Spreadsheets.Values.BatchUpdate(targetSpreadsheetId, &sheets.BatchUpdateValuesRequest{
+		ValueInputOption: valueInputOption(config.ValueInput),
+		Data: []*sheets.ValueRange{{
+			MajorDimension: "COLUMNS",
+			Range:          valueRange,
+			Values:         insertValues,
+		}},
+	}).Context(ctx).Do()
 }
 
-func copyTemplateIntoSheet(turnoutSourceId string, templateSheetId int64, targetSpreadsheet *sheets.Spreadsheet) error {
+// Brand-new spreadsheets always start with one empty sheet, and it's always
+// sheet 0 (the gid=0 in its URL)
+const defaultSheetId = 0
+
+// Copies the template tab in, then swaps it for the default sheet in one
+// BatchUpdate, naming it tabName. Two calls in all.
+func (c *Client) copyTemplateIntoSheet(ctx context.Context, turnoutSourceId string, templateSheetId int64, targetSpreadsheetId string, tabName string) error {
 	// Copy template sheet to new sheet
 	log.Print("Copying template into new spreadsheet")
-	newSheetProperties, err := sheetsService.Spreadsheets.Sheets.CopyTo(turnoutSourceId, templateSheetId, &sheets.CopySheetToAnotherSpreadsheetRequest{
-		DestinationSpreadsheetId: targetSpreadsheet.SpreadsheetId,
-	}).Do()
+	newSheetProperties, err := c.sheets.Spreadsheets.Sheets.CopyTo(turnoutSourceId, templateSheetId, &sheets.CopySheetToAnotherSpreadsheetRequest{
+		DestinationSpreadsheetId: targetSpreadsheetId,
+	}).Context(ctx).Do()
 	if err != nil {
 		log.Printf("Error copying template into spreadsheet: %v", err)
 		return err
 	}
 
-	// Note: this object is from the past, so it will not reflect the above update
-	// TODO: maybe check this error when it's actually created to avoid this paradox?
-	if len(targetSpreadsheet.Sheets) != 1 {
-		return errors.New(fmt.Sprintf("Brand-new spreadsheet %s should have only one sheet! Got %d", targetSpreadsheet.Properties.Title, len(targetSpreadsheet.Sheets)))
-	}
-	// Delete default empty sheet
-	log.Printf("Removing empty sheet from new spreadsheet")
-	_, err = sheetsService.Spreadsheets.BatchUpdate(targetSpreadsheet.SpreadsheetId, &sheets.BatchUpdateSpreadsheetRequest{
+	// Delete default empty sheet and rename the copied one. Requests in a
+	// BatchUpdate apply in order, so 'Sheet1' is free by the rename
+	log.Printf("Replacing empty sheet with the template")
+	_, err = c.sheets.Spreadsheets.BatchUpdate(targetSpreadsheetId, &sheets.BatchUpdateSpreadsheetRequest{
 		Requests: []*sheets.Request{
 			{
-				DeleteSheet: &sheets.DeleteSheetRequest{SheetId: targetSpreadsheet.Sheets[0].Properties.SheetId},
+				DeleteSheet: &sheets.DeleteSheetRequest{SheetId: defaultSheetId},
 			},
-		},
-	}).Do()
-	if err != nil {
-		log.Printf("Error removing empty sheet from spreadsheet %s: %v", targetSpreadsheet.Properties.Title, err)
-		return err
-	}
-
-	// Rename copied sheet to 'Sheet1'
-	log.Printf("Renaming new sheet to 'Sheet1'")
-	_, err = sheetsService.Spreadsheets.BatchUpdate(targetSpreadsheet.SpreadsheetId, &sheets.BatchUpdateSpreadsheetRequest{
-		Requests: []*sheets.Request{
 			{
 				UpdateSheetProperties: &sheets.UpdateSheetPropertiesRequest{
-					Fields: fmt.Sprintf("title"),
+					Fields: "title",
 					Properties: &sheets.SheetProperties{
 						SheetId: newSheetProperties.SheetId,
-						Title: "Sheet1",
+						Title: tabName,
 					},
 				},
 			},
 		},
-	}).Do()
+	}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("replacing empty sheet with the template: %w", err)
+	}
 	return nil
 }
 
+// CopySpreadsheet makes a batch as a Drive copy of a whole template
+// spreadsheet, so named ranges, protections, validation, scripts and every tab
+// come along, which copying one tab with Sheets loses. Like
+// CreateEmptySpreadsheet, it's stamped in the same call.
+func (c *Client) CopySpreadsheet(ctx context.Context, templateSpreadsheetId string, title string, appProperties map[string]string) (string, error) {
+	log.Printf("Copying template spreadsheet to %s", title)
+	f, err := c.drive.Files.Copy(templateSpreadsheetId, &drive.File{
+		Name:          title,
+		AppProperties: appProperties,
+	}).Fields("id").Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+	return f.Id, nil
+}
+
+// CreateEmptySpreadsheet makes a spreadsheet through Drive rather than Sheets,
+// so it can carry our app properties from the start instead of being stamped
+// in a second call.
 // TODO: it would be fun if this were idempotent by title
-func CreateEmptySpreadsheet(title string) (*sheets.Spreadsheet, error) {
+func (c *Client) CreateEmptySpreadsheet(ctx context.Context, title string, appProperties map[string]string) (string, error) {
 	log.Printf("Creating empty spreadsheet %s", title)
-	return sheetsService.Spreadsheets.Create(&sheets.Spreadsheet{
-		Properties: &sheets.SpreadsheetProperties{
-			Title: title,
-		},
-	}).Do()
+	f, err := c.drive.Files.Create(&drive.File{
+		Name:          title,
+		MimeType:      spreadsheetMimeType,
+		AppProperties: appProperties,
+	}).Fields("id").Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+	return f.Id, nil
 }
 
 func calculateBatches(numRows int, batchSize int, lastPageFudgeFactor int) int {
 	// Calculate number of batches
+	if numRows > 0 && numRows < batchSize {
+		return 1
+	}
 	if numRows%batchSize <= lastPageFudgeFactor {
 		return numRows / batchSize
 	}
 	return numRows/batchSize + 1
 }
 
-func getNamesAndNumbers(turnoutSourceId string, turnoutReadRange string, doTurnoutIdx int, firstNameIdx int, phoneIdx int) ([]interface{}, []interface{}, error) {
-	resp, err := sheetsService.Spreadsheets.Values.Get(turnoutSourceId, turnoutReadRange).Do()
+func (c *Client) getSourceRows(ctx context.Context, turnoutSourceId string, turnoutReadRange string) ([][]interface{}, error) {
+	resp, err := c.sheets.Spreadsheets.Values.Get(turnoutSourceId, turnoutReadRange).Context(ctx).Do()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	// Extract names and phone numbers
-	// TODO: this number is super wrong
-	// TODO: no error case right now
 	log.Printf("Got %d rows from source sheet", len(resp.Values))
-	names := make([]interface{}, 0, len(resp.Values))
-	numbers := make([]interface{}, 0, len(resp.Values))
-	for _, row := range resp.Values {
-		// Assign columns to variables
-		if len(row) == 4 && row[doTurnoutIdx] == "TRUE" {
-			names = append(names, row[firstNameIdx])
-			numbers = append(numbers, row[phoneIdx])
-		}
-	}
-	return names, numbers, nil
+	return resp.Values, nil
 }
 
-func getClient() (*http.Client, error) {
-	// Get creds
-	b, err := os.ReadFile("credentials.json")
+// Reads the message template out of a cell of the source spreadsheet. If the
+// range is bigger than one cell, the top left one is it.
+func (c *Client) getMessageTemplate(ctx context.Context, turnoutSourceId string, templateRange string) (string, error) {
+	resp, err := c.sheets.Spreadsheets.Values.Get(turnoutSourceId, templateRange).Context(ctx).Do()
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-
-	authConfig, err := google.ConfigFromJSON(b, "https://www.googleapis.com/auth/drive")
-	if err != nil {
-		return nil, err
+	if len(resp.Values) == 0 || len(resp.Values[0]) == 0 || fmt.Sprint(resp.Values[0][0]) == "" {
+		return "", fmt.Errorf("no message template in %s", templateRange)
 	}
-	return GetClient(authConfig), nil
+	return fmt.Sprint(resp.Values[0][0]), nil
 }
 
 func getSheetsService(client *http.Client, ctx context.Context) (srv *sheets.Service, err error) {
@@ -253,20 +450,25 @@ func getDriveService(client *http.Client, ctx context.Context) (srv *drive.Servi
 	return
 }
 
-func init() {
-	ctx := context.Background()
-	client, err := getClient()
+// NewClient authenticates as auth's account with the given scopes and sets up
+// the API services. Commands that talk to Google make their own, so things
+// like `config show` work without creds.
+func NewClient(ctx context.Context, auth conf.AuthConfig, scopes ...string) (*Client, error) {
+	client, err := getClient(ctx, auth, scopes...)
 	if err != nil {
-		log.Fatalf("Failed to create Google API client: %v", err)
+		return nil, fmt.Errorf("failed to create Google API client: %w", err)
 	}
 
-	sheetsService, err = getSheetsService(client, ctx)
+	countCalls(client)
+	c := &Client{Account: auth.Account}
+	c.sheets, err = getSheetsService(client, ctx)
 	if err != nil {
-		log.Fatalf("Failed to create Google Sheets API service: %v", err)
+		return nil, fmt.Errorf("failed to create Google Sheets API service: %w", err)
 	}
 
-	driveService, err = getDriveService(client, ctx)
+	c.drive, err = getDriveService(client, ctx)
 	if err != nil {
-		log.Fatalf("Failed to create Google Drive API service: %v", err)
+		return nil, fmt.Errorf("failed to create Google Drive API service: %w", err)
 	}
+	return c, nil
 }
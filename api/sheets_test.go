@@ -0,0 +1,200 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-ogle-sheets/conf"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+)
+
+// A request the fake saw, body and all
+type fakeRequest struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+// fakeGoogle stands in for both Sheets and Drive. Routes are "METHOD path
+// prefix"; anything unrouted gets a 404.
+type fakeGoogle struct {
+	mu       sync.Mutex
+	routes   map[string]http.HandlerFunc
+	requests []fakeRequest
+}
+
+func (g *fakeGoogle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	g.mu.Lock()
+	g.requests = append(g.requests, fakeRequest{r.Method, r.URL.Path, string(body)})
+	g.mu.Unlock()
+	// The longest matching prefix wins, so "POST /files" doesn't catch copies
+	var best http.HandlerFunc
+	bestLen := -1
+	for route, handler := range g.routes {
+		method, prefix, _ := strings.Cut(route, " ")
+		if r.Method == method && strings.HasPrefix(r.URL.Path, prefix) && len(prefix) > bestLen {
+			best, bestLen = handler, len(prefix)
+		}
+	}
+	if best != nil {
+		best(w, r)
+		return
+	}
+	http.Error(w, `{"error": {"code": 404, "message": "not found"}}`, http.StatusNotFound)
+}
+
+// Requests the fake saw with the given method and path prefix
+func (g *fakeGoogle) seen(method string, prefix string) []fakeRequest {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var matching []fakeRequest
+	for _, r := range g.requests {
+		if r.Method == method && strings.HasPrefix(r.Path, prefix) {
+			matching = append(matching, r)
+		}
+	}
+	return matching
+}
+
+func respondJSON(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}
+}
+
+func respondError(code int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": {"code": 400, "message": "nope"}}`, code)
+	}
+}
+
+// A Client talking to fake, counting calls like NewClient's does
+func newFakeClient(t *testing.T, fake *fakeGoogle) *Client {
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	ctx := context.Background()
+	httpClient := srv.Client()
+	countCalls(httpClient)
+	opts := []option.ClientOption{option.WithEndpoint(srv.URL + "/"), option.WithHTTPClient(httpClient)}
+	sheetsService, err := sheets.NewService(ctx, opts...)
+	if err != nil {
+		t.Fatalf("Failed to make Sheets service: %v", err)
+	}
+	driveService, err := drive.NewService(ctx, opts...)
+	if err != nil {
+		t.Fatalf("Failed to make Drive service: %v", err)
+	}
+	return &Client{sheets: sheetsService, drive: driveService}
+}
+
+func testBatchPlan() (*Plan, *PlannedBatch) {
+	batch := &PlannedBatch{Group: 1, Title: "Turnout 1/5 - Group 1", Count: 1, Names: []interface{}{"Ana"}, Numbers: []interface{}{"555-0101"}}
+	return &Plan{RunId: "run", Date: "1/5", Batches: []*PlannedBatch{batch}}, batch
+}
+
+func testBatchConfig() conf.GenerationConfig {
+	config := testGenerationConfig()
+	config.TurnoutSourceId = "1source"
+	config.TemplateSheetId = 42
+	config.TargetRange = "Sheet1!A2"
+	config.Columns = conf.DefaultColumns
+	config.ValueInput = conf.ValueInputRaw
+	return config
+}
+
+func TestExecuteBatchCountsCalls(t *testing.T) {
+	fake := &fakeGoogle{routes: map[string]http.HandlerFunc{
+		"POST /files":                   respondJSON(`{"id": "1new"}`),
+		"POST /v4/spreadsheets/1source": respondError(http.StatusBadRequest),
+		"DELETE /files/1new":            respondJSON(``),
+	}}
+	client := newFakeClient(t, fake)
+	plan, batch := testBatchPlan()
+
+	var logs bytes.Buffer
+	oldOutput := log.Writer()
+	log.SetOutput(&logs)
+	Verbose = true
+	defer func() {
+		log.SetOutput(oldOutput)
+		Verbose = false
+	}()
+	if _, err := client.executeBatch(context.Background(), testBatchConfig(), plan, batch); err == nil {
+		t.Fatalf("Expected the failed template copy to fail the batch")
+	}
+	// Create, the copy that failed, and the rollback: not the two a full copy takes
+	if !strings.Contains(logs.String(), batch.Title+": 3 API calls") {
+		t.Fatalf("Wrong call count; expected 3, got logs:\n%s", logs.String())
+	}
+}
+
+type rollbackTestConf struct {
+	name   string
+	values http.HandlerFunc
+}
+
+var rollbackTests = []rollbackTestConf{
+	{"fails", respondError(http.StatusBadRequest)},
+	{"hangs", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}},
+}
+
+func TestExecuteBatchRollsBack(t *testing.T) {
+	for _, test := range rollbackTests {
+		fake := &fakeGoogle{routes: map[string]http.HandlerFunc{
+			"POST /files/1template/copy":                    respondJSON(`{"id": "1new"}`),
+			"POST /v4/spreadsheets/1new/values:batchUpdate": test.values,
+			"DELETE /files/1new":                            respondJSON(``),
+		}}
+		client := newFakeClient(t, fake)
+		plan, batch := testBatchPlan()
+		config := testBatchConfig()
+		config.TemplateSpreadsheetId = "1template"
+		config.Timeout = 200 * time.Millisecond
+
+		created, err := client.executeBatch(context.Background(), config, plan, batch)
+		if err == nil || created {
+			t.Fatalf("Expected a batch whose values write %s to fail and not count as created, got %v, %v", test.name, created, err)
+		}
+		if deletes := fake.seen("DELETE", "/files/1new"); len(deletes) != 1 {
+			t.Fatalf("Expected the half-made spreadsheet to be deleted once when the write %s, got %d deletes", test.name, len(deletes))
+		}
+	}
+}
+
+// Restore needs ForceSendFields, or the false is left out and nothing happens
+func TestTrashAndRestoreSpreadsheet(t *testing.T) {
+	fake := &fakeGoogle{routes: map[string]http.HandlerFunc{
+		"PATCH /files/1abc": respondJSON(`{}`),
+	}}
+	client := newFakeClient(t, fake)
+	if err := client.TrashSpreadsheet(context.Background(), "1abc"); err != nil {
+		t.Fatalf("Unexpected error trashing: %v", err)
+	}
+	if err := client.RestoreSpreadsheet(context.Background(), "1abc"); err != nil {
+		t.Fatalf("Unexpected error restoring: %v", err)
+	}
+	patches := fake.seen("PATCH", "/files/1abc")
+	expected := []string{`"trashed":true`, `"trashed":false`}
+	if len(patches) != len(expected) {
+		t.Fatalf("Wrong number of PATCHes; expected %d, got %d", len(expected), len(patches))
+	}
+	for i, body := range expected {
+		if !strings.Contains(patches[i].Body, body) {
+			t.Fatalf("Wrong PATCH body; expected %v, got %v", body, patches[i].Body)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package api
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"go-ogle-sheets/conf"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/oauth2"
+)
+
+// TokenStore is where a signed-in user's token (and the scopes it was granted)
+// is kept between runs. Load returns an error wrapping os.ErrNotExist when
+// nothing has been saved yet.
+type TokenStore interface {
+	Load() (*oauth2.Token, []string, error)
+	Save(tok *oauth2.Token, scopes []string) error
+	Delete() error
+	// Where the token lives, for messages
+	String() string
+}
+
+// Token store kinds for --token-store
+const (
+	TokenStoreFile      = "file"
+	TokenStoreEncrypted = "encrypted"
+	TokenStoreMemory    = "memory"
+)
+
+// newTokenStore picks the store auth asks for. Encrypted tokens sit next to
+// where the plain one would be, with .enc instead of .json.
+func newTokenStore(auth conf.AuthConfig) (TokenStore, error) {
+	path := auth.TokenFile
+	if path == "" {
+		path = legacyTokenFile
+	}
+	switch auth.TokenStore {
+	case "", TokenStoreFile:
+		return &FileTokenStore{Path: path}, nil
+	case TokenStoreEncrypted:
+		secret := []byte(auth.TokenPassphrase)
+		if auth.TokenKeyFile != "" {
+			b, err := os.ReadFile(auth.TokenKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't read token key file: %w", err)
+			}
+			secret = b
+		}
+		if len(secret) == 0 {
+			return nil, errors.New("the encrypted token store needs --token-key-file or TURNOUT_TOKEN_PASSPHRASE")
+		}
+		return NewEncryptedFileTokenStore(strings.TrimSuffix(path, ".json")+".enc", secret), nil
+	case TokenStoreMemory:
+		return NewMemoryTokenStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown token store %q; use file, encrypted or memory", auth.TokenStore)
+	}
+}
+
+// What's kept on disk: the token, plus the scopes it was granted so we know
+// when to ask for more. Embedding keeps old token.json files readable.
+type savedToken struct {
+	*oauth2.Token
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+func encodeToken(tok *oauth2.Token, scopes []string) ([]byte, error) {
+	return json.Marshal(savedToken{Token: tok, Scopes: scopes})
+}
+
+func decodeToken(b []byte, where string) (*oauth2.Token, []string, error) {
+	saved := &savedToken{}
+	if err := json.Unmarshal(b, saved); err != nil {
+		return nil, nil, err
+	}
+	if saved.Token == nil {
+		return nil, nil, fmt.Errorf("no token in %s", where)
+	}
+	if saved.Scopes == nil {
+		saved.Scopes = legacyScopes
+	}
+	return saved.Token, saved.Scopes, nil
+}
+
+// Writes b to path, readable only by us, making the directory if needed
+func writePrivateFile(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0600)
+}
+
+// FileTokenStore keeps the token as plain JSON, like token.json always was.
+type FileTokenStore struct {
+	Path string
+}
+
+func (s *FileTokenStore) Load() (*oauth2.Token, []string, error) {
+	b, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return decodeToken(b, s.Path)
+}
+
+func (s *FileTokenStore) Save(tok *oauth2.Token, scopes []string) error {
+	b, err := encodeToken(tok, scopes)
+	if err != nil {
+		return err
+	}
+	return writePrivateFile(s.Path, b)
+}
+
+func (s *FileTokenStore) Delete() error {
+	return os.Remove(s.Path)
+}
+
+func (s *FileTokenStore) String() string {
+	return s.Path
+}
+
+// EncryptedFileTokenStore keeps the token encrypted with AES-256-GCM, under a
+// key derived with scrypt from a passphrase or the contents of a key file.
+// Each save gets a fresh salt and nonce.
+type EncryptedFileTokenStore struct {
+	Path   string
+	secret []byte
+}
+
+// scrypt cost parameters; the ones recommended for interactive logins
+const (
+	scryptN       = 1 << 15
+	scryptR       = 8
+	scryptP       = 1
+	scryptKeyLen  = 32
+	scryptSaltLen = 16
+)
+
+// On disk. Version is so we can change the parameters later
+type encryptedToken struct {
+	Version    int    `json:"version"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func NewEncryptedFileTokenStore(path string, secret []byte) *EncryptedFileTokenStore {
+	return &EncryptedFileTokenStore{Path: path, secret: secret}
+}
+
+func (s *EncryptedFileTokenStore) gcm(salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(s.secret, salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *EncryptedFileTokenStore) Load() (*oauth2.Token, []string, error) {
+	b, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var enc encryptedToken
+	if err := json.Unmarshal(b, &enc); err != nil {
+		return nil, nil, fmt.Errorf("%s isn't an encrypted token: %w", s.Path, err)
+	}
+	if enc.Version != 1 {
+		return nil, nil, fmt.Errorf("%s has unknown encrypted token version %d", s.Path, enc.Version)
+	}
+	gcm, err := s.gcm(enc.Salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(enc.Nonce) != gcm.NonceSize() {
+		return nil, nil, fmt.Errorf("%s has a bad nonce", s.Path)
+	}
+	plain, err := gcm.Open(nil, enc.Nonce, enc.Ciphertext, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't decrypt %s; wrong passphrase or key file?", s.Path)
+	}
+	return decodeToken(plain, s.Path)
+}
+
+func (s *EncryptedFileTokenStore) Save(tok *oauth2.Token, scopes []string) error {
+	plain, err := encodeToken(tok, scopes)
+	if err != nil {
+		return err
+	}
+	enc := encryptedToken{Version: 1, Salt: make([]byte, scryptSaltLen)}
+	if _, err := rand.Read(enc.Salt); err != nil {
+		return err
+	}
+	gcm, err := s.gcm(enc.Salt)
+	if err != nil {
+		return err
+	}
+	enc.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(enc.Nonce); err != nil {
+		return err
+	}
+	enc.Ciphertext = gcm.Seal(nil, enc.Nonce, plain, nil)
+	b, err := json.Marshal(enc)
+	if err != nil {
+		return err
+	}
+	return writePrivateFile(s.Path, b)
+}
+
+func (s *EncryptedFileTokenStore) Delete() error {
+	return os.Remove(s.Path)
+}
+
+func (s *EncryptedFileTokenStore) String() string {
+	return s.Path + " (encrypted)"
+}
+
+// MemoryTokenStore only lasts as long as the process, so every run signs in
+// again. Handy when nothing should touch the disk, and for tests.
+type MemoryTokenStore struct {
+	mu     sync.Mutex
+	tok    *oauth2.Token
+	scopes []string
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{}
+}
+
+func (s *MemoryTokenStore) Load() (*oauth2.Token, []string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tok == nil {
+		return nil, nil, fmt.Errorf("no token in memory: %w", os.ErrNotExist)
+	}
+	tok := *s.tok
+	return &tok, s.scopes, nil
+}
+
+func (s *MemoryTokenStore) Save(tok *oauth2.Token, scopes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := *tok
+	s.tok, s.scopes = &saved, scopes
+	return nil
+}
+
+func (s *MemoryTokenStore) Delete() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tok == nil {
+		return fmt.Errorf("no token in memory: %w", os.ErrNotExist)
+	}
+	s.tok, s.scopes = nil, nil
+	return nil
+}
+
+func (s *MemoryTokenStore) String() string {
+	return "memory"
+}
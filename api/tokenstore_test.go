@@ -0,0 +1,155 @@
+package api
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-ogle-sheets/conf"
+	"golang.org/x/oauth2"
+)
+
+// Every store should give back what it was given, and ErrNotExist before and
+// after
+func testTokenStore(t *testing.T, store TokenStore) {
+	if _, _, err := store.Load(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected ErrNotExist from empty %s, got %v", store, err)
+	}
+	tok := &oauth2.Token{AccessToken: "a", RefreshToken: "r", TokenType: "Bearer"}
+	scopes := []string{"one", "two"}
+	if err := store.Save(tok, scopes); err != nil {
+		t.Fatalf("Unexpected error saving to %s: %v", store, err)
+	}
+	loaded, loadedScopes, err := store.Load()
+	if err != nil {
+		t.Fatalf("Unexpected error loading from %s: %v", store, err)
+	}
+	if loaded.AccessToken != "a" || loaded.RefreshToken != "r" {
+		t.Fatalf("Wrong token from %s; expected %v, got %v", store, tok, loaded)
+	}
+	if !reflect.DeepEqual(loadedScopes, scopes) {
+		t.Fatalf("Wrong scopes from %s; expected %v, got %v", store, scopes, loadedScopes)
+	}
+	if err := store.Delete(); err != nil {
+		t.Fatalf("Unexpected error deleting from %s: %v", store, err)
+	}
+	if _, _, err := store.Load(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected ErrNotExist after deleting from %s, got %v", store, err)
+	}
+}
+
+func TestFileTokenStore(t *testing.T) {
+	// Makes the tokens directory too
+	testTokenStore(t, &FileTokenStore{Path: filepath.Join(t.TempDir(), "tokens", "default.json")})
+}
+
+func TestFileTokenStoreLegacy(t *testing.T) {
+	// Plain oauth2.Token JSON, as token.json used to be written
+	path := filepath.Join(t.TempDir(), "token.json")
+	if err := os.WriteFile(path, []byte(`{"access_token":"a","refresh_token":"r"}`), 0600); err != nil {
+		t.Fatalf("Failed to write token: %v", err)
+	}
+	tok, scopes, err := (&FileTokenStore{Path: path}).Load()
+	if err != nil || tok.RefreshToken != "r" {
+		t.Fatalf("Wrong token read back; expected %v, got %v (%v)", "r", tok, err)
+	}
+	if !reflect.DeepEqual(scopes, legacyScopes) {
+		t.Fatalf("Wrong scopes for legacy token; expected %v, got %v", legacyScopes, scopes)
+	}
+}
+
+func TestEncryptedFileTokenStore(t *testing.T) {
+	testTokenStore(t, NewEncryptedFileTokenStore(filepath.Join(t.TempDir(), "default.enc"), []byte("correct horse")))
+}
+
+func TestEncryptedFileTokenStoreAtRest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "default.enc")
+	store := NewEncryptedFileTokenStore(path, []byte("correct horse"))
+	if err := store.Save(&oauth2.Token{RefreshToken: "secret-refresh-token"}, nil); err != nil {
+		t.Fatalf("Unexpected error saving: %v", err)
+	}
+	b, _ := os.ReadFile(path)
+	if strings.Contains(string(b), "secret-refresh-token") {
+		t.Fatalf("Refresh token is readable in %s", b)
+	}
+	_, _, err := NewEncryptedFileTokenStore(path, []byte("wrong horse")).Load()
+	if err == nil || !strings.Contains(err.Error(), "decrypt") {
+		t.Fatalf("Expected decrypt error with the wrong passphrase, got %v", err)
+	}
+}
+
+func TestMemoryTokenStore(t *testing.T) {
+	testTokenStore(t, NewMemoryTokenStore())
+}
+
+type newTokenStoreTestConf struct {
+	auth     conf.AuthConfig
+	expected string // store.String(), or the error
+}
+
+var newTokenStoreTests = []newTokenStoreTestConf{
+	{conf.AuthConfig{TokenFile: "tokens/default.json"}, "tokens/default.json"},
+	{conf.AuthConfig{TokenFile: "tokens/default.json", TokenStore: "encrypted", TokenPassphrase: "pw"}, "tokens/default.enc (encrypted)"},
+	{conf.AuthConfig{TokenFile: "tokens/default.json", TokenStore: "encrypted"}, "needs --token-key-file"},
+	{conf.AuthConfig{TokenStore: "memory"}, "memory"},
+	{conf.AuthConfig{TokenStore: "keychain"}, "unknown token store"},
+}
+
+func TestNewTokenStore(t *testing.T) {
+	for _, test := range newTokenStoreTests {
+		store, err := newTokenStore(test.auth)
+		actual := ""
+		if err != nil {
+			actual = err.Error()
+		} else {
+			actual = store.String()
+		}
+		if !strings.Contains(actual, test.expected) {
+			t.Fatalf("Wrong token store for %+v; expected %v, got %v", test.auth, test.expected, actual)
+		}
+	}
+}
+
+type legacyMigrationTestConf struct {
+	profile  string
+	account  string
+	migrates bool
+}
+
+var legacyMigrationTests = []legacyMigrationTestConf{
+	{"", "", true},
+	{"chapter-b", "", false},
+	{"", "chapter-b", false},
+}
+
+func TestLoadTokenLegacyMigration(t *testing.T) {
+	for _, test := range legacyMigrationTests {
+		dir := t.TempDir()
+		t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+		wd, _ := os.Getwd()
+		if err := os.Chdir(dir); err != nil {
+			t.Fatal(err)
+		}
+		legacy := &FileTokenStore{Path: legacyTokenFile}
+		if err := legacy.Save(&oauth2.Token{AccessToken: "original user"}, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		auth := conf.AuthConfig{Account: test.account, TokenFile: conf.TokenPath(test.profile, test.account)}
+		store, _ := newTokenStore(auth)
+		tok, _, err := loadToken(store, ownsLegacyToken(auth))
+		_, legacyErr := os.Stat(legacyTokenFile)
+		os.Chdir(wd)
+
+		if test.migrates {
+			if err != nil || tok.AccessToken != "original user" || !errors.Is(legacyErr, os.ErrNotExist) {
+				t.Fatalf("Expected the default token to take over %s, got %v, %v (left behind: %v)", legacyTokenFile, tok, err, legacyErr == nil)
+			}
+		} else if !errors.Is(err, os.ErrNotExist) || legacyErr != nil {
+			t.Fatalf("Expected profile %q / account %q to leave %s alone, got %v, %v", test.profile, test.account, legacyTokenFile, tok, err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go-ogle-sheets/api"
+)
+
+// authCmd represents the auth command
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage the Google account turnout signs in as",
+	Long: `Manage the Google account turnout signs in as. Tokens are kept per profile
+under $XDG_CONFIG_HOME/turnout/tokens, so each profile can use its own account.`,
+}
+
+var authLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Sign in through the browser, replacing any saved token",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := api.Login(cmd.Context(), authConfig); err != nil {
+			log.Fatalf("Login failed: %v", err)
+		}
+		fmt.Println("Logged in")
+	},
+}
+
+var authLogoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Revoke and delete the saved token",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := api.Logout(cmd.Context(), authConfig); err != nil {
+			log.Fatalf("Logout failed: %v", err)
+		}
+		fmt.Println("Logged out")
+	},
+}
+
+var authStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show who turnout is signed in as",
+	Run: func(cmd *cobra.Command, args []string) {
+		status, err := api.Status(cmd.Context(), authConfig)
+		if err != nil {
+			log.Fatalf("Couldn't check auth status: %v", err)
+		}
+		if authConfig.Account != "" {
+			fmt.Printf("Account:     %s (from config)\n", authConfig.Account)
+		}
+		fmt.Printf("Credentials: %s\n", status.CredentialsType)
+		if status.TokenStore != "" {
+			fmt.Printf("Token:       %s\n", status.TokenStore)
+		}
+		if !status.LoggedIn {
+			fmt.Println("Not logged in; run `turnout auth login`")
+			return
+		}
+		fmt.Printf("Signed in:   %s\n", status.Account)
+		fmt.Printf("Scopes:      %s\n", strings.Join(status.Scopes, " "))
+		if !status.Expiry.IsZero() {
+			fmt.Printf("Expires:     %s (in %s)\n", status.Expiry.Local().Format(time.RFC1123), time.Until(status.Expiry).Round(time.Second))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(authCmd)
+	authCmd.AddCommand(authLoginCmd)
+	authCmd.AddCommand(authLogoutCmd)
+	authCmd.AddCommand(authStatusCmd)
+}
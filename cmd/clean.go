@@ -4,12 +4,17 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"github.com/spf13/cobra"
 	"go-ogle-sheets/api"
 	"go-ogle-sheets/conf"
+	"go-ogle-sheets/util"
 	"log"
+	"os"
 	"strings"
+	"text/tabwriter"
+	"time"
 )
 
 var cleanConfig conf.CleanConfig
@@ -18,62 +23,86 @@ var cleanConfig conf.CleanConfig
 var cleanCmd = &cobra.Command{
 	Use:   "clean",
 	Short: "Remove some set of generated turnout sheets",
-	Long:  `Remove some set of generated turnout sheets`,
+	Long: `Remove some set of generated turnout sheets. They go to the Drive trash
+(and can be brought back with restore) unless --permanent is passed.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		var driveFiles []*api.DriveFile
-		var err error
-		if cleanConfig.Q != "" {
-			driveFiles, err = api.AllSpreadsheetsByQ(cleanConfig.Q)
-		} else if cleanConfig.MatchPattern != "" {
-			driveFiles, err = api.AllSpreadsheetsByPartialName(cleanConfig.MatchPattern)
-		} else {
-			driveFiles, err = api.AllSpreadsheetsByPartialName(api.SpreadsheetNamePrefixFromDate(cleanConfig.Date))
+		// Checked here rather than with MarkFlagsOneRequired so the date can come from env or config
+		if err := cleanConfig.Validate(); err != nil {
+			log.Fatalf("Invalid configuration:\n%v", err)
+		}
+		if err := cleanConfig.ResolveDates(time.Now()); err != nil {
+			log.Fatalf("Invalid date: %v", err)
 		}
+		ctx := cmd.Context()
+		client, err := api.NewClient(ctx, authConfig, api.CleanScopes(cleanConfig)...)
 		if err != nil {
-			log.Fatalf("Failed to get spreadsheets by name: %v", err)
+			log.Fatalf("Failed to initialize Google API client: %v", err)
 		}
 
-		names := make([]string, len(driveFiles))
-		ids := make([]string, len(driveFiles))
-		for i, f := range driveFiles {
-			names[i] = f.Name
-			ids[i] = f.Id
+		searchCtx, cancel := withTimeout(ctx, cleanConfig.Timeout)
+		driveFiles, err := client.FindSpreadsheets(searchCtx, searchBase(cleanConfig, false), cleanConfig)
+		cancel()
+		if err != nil {
+			log.Fatalf("Failed to get spreadsheets by name: %v", err)
 		}
 
 		if len(driveFiles) == 0 {
 			fmt.Println("Found no matches.")
 		} else {
-			fmt.Printf("Found %d matches. IDs: %s\n", len(driveFiles), strings.Join(names, ", "))
+			fmt.Printf("Found %d matches:\n", len(driveFiles))
+			tableCtx, cancel := withTimeout(ctx, cleanConfig.Timeout)
+			printFileTable(tableCtx, client, driveFiles)
+			cancel()
 			if !cleanConfig.Test {
+				prompt, remove := "Move %d spreadsheets to the trash?", client.TrashSpreadsheet
+				if cleanConfig.Permanent {
+					prompt, remove = "PERMANENTLY delete %d spreadsheets? This can't be undone.", client.DeleteSpreadsheet
+				}
 				// Confirmation might as well live here, def not in the api client wrapper layer...
 				var confirm string
-				fmt.Printf("Delete %d spreadsheets? (only 'yes' will be accepted): ", len(driveFiles))
-				fmt.Scan(&confirm)
+				if cleanConfig.Yes {
+					confirm = "yes"
+				} else {
+					if !stdinIsTerminal() {
+						log.Fatalf("Not prompting for confirmation since stdin isn't a terminal; pass --yes to clean without asking")
+					}
+					fmt.Printf(prompt+" (only 'yes' will be accepted): ", len(driveFiles))
+					// Ctrl-D or anything else unreadable is a no
+					if _, err := fmt.Scan(&confirm); err != nil {
+						fmt.Println()
+						confirm = ""
+					}
+				}
 				if confirm == "yes" {
-					ch := make(chan error, cleanConfig.Concurrency)
-					for _, id := range ids {
-						go func(ch chan error) {
-							err := api.DeleteSpreadsheet(id)
+					if cleanConfig.Archive != "" {
+						// One spreadsheet at a time, so --timeout bounds each like it does removals
+						for _, f := range driveFiles {
+							opCtx, cancel := withTimeout(ctx, cleanConfig.Timeout)
+							err := archive(opCtx, client, cleanConfig.Archive, cleanConfig.ArchiveFormat, []*api.DriveFile{f})
+							cancel()
 							if err != nil {
-								log.Printf("Error while deleting spreadsheet %s: %v", id, err)
+								log.Fatalf("Failed to archive spreadsheets, so not removing anything: %v", err)
 							}
-							ch<-err
-						}(ch)
-					}
-					errs := make([]error, 0, len(ids))
-					for i := 0; i < len(ids); i++ {
-						e := <-ch
-						if e != nil {
-							errs = append(errs, e)
-						}
-						if i >= len(ids) { // TODO this is clumsy
-							close(ch)
 						}
+						fmt.Printf("Archived %d spreadsheets to %s\n", len(driveFiles), cleanConfig.Archive)
 					}
+					errs := util.RunConcurrently(len(driveFiles), cleanConfig.Concurrency, func(i int) error {
+						opCtx, cancel := withTimeout(ctx, cleanConfig.Timeout)
+						defer cancel()
+						err := remove(opCtx, driveFiles[i].Id)
+						if err != nil {
+							log.Printf("Error while removing spreadsheet %s: %v", driveFiles[i].Id, err)
+						}
+						return err
+					})
 					if len(errs) > 0 {
-						log.Fatalf("Got errors while concurrentl deleting! %v", errs)
+						log.Fatalf("Got errors while concurrently removing! %v", errs)
+					}
+					if cleanConfig.Permanent {
+						fmt.Printf("Deleted %d spreadsheets\n", len(driveFiles))
+					} else {
+						fmt.Printf("Trashed %d spreadsheets (undo with `turnout restore`)\n", len(driveFiles))
 					}
-					fmt.Printf("Deleted %d spreadsheets\n", len(driveFiles))
 				} else {
 					fmt.Println("Not deleting.")
 				}
@@ -82,16 +111,131 @@ var cleanCmd = &cobra.Command{
 	},
 }
 
+// Saves the contents of every spreadsheet before clean removes them. dest is
+// a spreadsheet (a Sheets URL, or sheet:<id>) to append to, a single .csv
+// file, or a directory. A bare ID looks too much like a directory name
+// ("weekly-turnout-archives-2025") to guess.
+func archive(ctx context.Context, client *api.Client, dest string, format string, driveFiles []*api.DriveFile) error {
+	if id, ok := strings.CutPrefix(dest, archiveSheetPrefix); ok {
+		id, ok = api.SpreadsheetIdFromString(id)
+		if !ok {
+			return fmt.Errorf("%q isn't a spreadsheet URL or ID", dest)
+		}
+		return client.ArchiveToSpreadsheet(ctx, id, driveFiles)
+	}
+	if id, ok := api.SpreadsheetIdFromURL(dest); ok {
+		return client.ArchiveToSpreadsheet(ctx, id, driveFiles)
+	}
+	if stat, err := os.Stat(dest); (err == nil && stat.IsDir()) || !strings.HasSuffix(strings.ToLower(dest), ".csv") {
+		return client.ArchiveToDir(ctx, dest, format, driveFiles)
+	}
+	// A rerun (say, after some removals timed out) carries on the same file
+	f, err := os.OpenFile(dest, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	archived, err := api.ArchivedIds(f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %w", dest, err)
+	}
+	var todo []*api.DriveFile
+	for _, file := range driveFiles {
+		if !archived[file.Id] {
+			todo = append(todo, file)
+		}
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = client.ArchiveToCSV(ctx, f, todo, stat.Size() == 0)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Prints who owns each file, when it was made, who touched it last and where
+// it lives, flagging ones someone else has edited since
+func printFileTable(ctx context.Context, client *api.Client, driveFiles []*api.DriveFile) {
+	var parents []string
+	for _, f := range driveFiles {
+		parents = append(parents, f.Parents...)
+	}
+	folders := client.FolderNames(ctx, parents)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tOWNER\tCREATED\tLAST MODIFIED BY\tFOLDER\t")
+	modifiedByOthers := 0
+	for _, f := range driveFiles {
+		folderNames := make([]string, len(f.Parents))
+		for i, p := range f.Parents {
+			folderNames[i] = folders[p]
+		}
+		var warnings []string
+		if f.ModifiedByOthers() {
+			warnings = append(warnings, "(!) edited by someone else")
+			modifiedByOthers++
+		}
+		if !f.Managed() {
+			warnings = append(warnings, "(!) not made by generate")
+		}
+		warning := strings.Join(warnings, " ")
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", f.Name, strings.Join(f.Owners, ", "), f.CreatedTime.Local().Format("2006-01-02 15:04"), f.LastModifiedBy, strings.Join(folderNames, ", "), warning)
+	}
+	w.Flush()
+	if modifiedByOthers > 0 {
+		fmt.Printf("WARNING: %d of these were last edited by someone other than their owner, so they may hold notes you want to keep.\n", modifiedByOthers)
+	}
+}
+
+// Marks --archive as a spreadsheet ID rather than a path
+const archiveSheetPrefix = "sheet:"
+
+func stdinIsTerminal() bool {
+	stat, err := os.Stdin.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// Only spreadsheets generate stamped, unless asked otherwise
+func searchBase(config conf.CleanConfig, trashed bool) *api.Query {
+	q := api.NewQuery().Trashed(trashed)
+	if !config.IncludeUnmanaged {
+		q.AppProperty(api.ManagedProperty, "true")
+	}
+	return q
+}
+
+// Flags for finding generated spreadsheets, shared by clean and restore
+func addSearchFlags(cmd *cobra.Command, config *conf.CleanConfig) {
+	cmd.Flags().StringVarP(&config.Date, "date", "d", "", "Date for created spreadsheet titles (e.g. 2025-01-05, 1/5, Jan 5, today, -7d, last thursday)")
+	cmd.Flags().StringVar(&config.Since, "since", "", "Match spreadsheets dated on or after this date")
+	cmd.Flags().StringVar(&config.Until, "until", "", "Match spreadsheets dated on or before this date")
+	cmd.Flags().StringVar(&config.DateLayout, "date-layout", conf.DefaultDateLayout, "Go time layout dates are written in within titles (must match generate's)")
+	cmd.Flags().StringVarP(&config.MatchPattern, "match", "m", "", "Pattern to match (will override --date specification)")
+	cmd.Flags().StringVarP(&config.Q, "q", "q", "", "Full Google API query")
+	cmd.MarkFlagsMutuallyExclusive("date", "match", "q")
+	cmd.MarkFlagsMutuallyExclusive("date", "since")
+	cmd.MarkFlagsMutuallyExclusive("date", "until")
+	cmd.Flags().StringVar(&config.TitleTemplate, "title-template", conf.DefaultTitleTemplate, "Go template the spreadsheets were titled with (must match generate's)")
+
+	cmd.Flags().StringVar(&config.OlderThan, "older-than", "", "Only match spreadsheets created more than this long ago, e.g. 30d or 8w")
+	cmd.Flags().BoolVar(&config.IncludeUnmanaged, "include-unmanaged", false, "Also match spreadsheets generate didn't make (e.g. a volunteer's own sheet with the same title)")
+
+	cmd.Flags().IntVarP(&config.Concurrency, "concurrency", "c", 6, "Maximum number of simultaneous goroutines for API operations")
+	cmd.Flags().DurationVar(&config.Timeout, "timeout", time.Minute, "Give up on the search, or on any one file, after this long; 0 for no limit")
+}
+
 func init() {
 	rootCmd.AddCommand(cleanCmd)
 
-	cleanCmd.Flags().StringVarP(&cleanConfig.Date, "date", "d", "", "Date for created spreadsheet titles")
-	cleanCmd.Flags().StringVarP(&cleanConfig.MatchPattern, "match", "m", "", "Pattern to match (will override --date specification)")
-	cleanCmd.Flags().StringVarP(&cleanConfig.Q, "q", "q", "", "Full Google API query")
-	cleanCmd.MarkFlagsMutuallyExclusive("date", "match", "q")
-	cleanCmd.MarkFlagsOneRequired("date", "match", "q")
-
+	addSearchFlags(cleanCmd, &cleanConfig)
 	cleanCmd.Flags().BoolVarP(&cleanConfig.Test, "test", "t", false, "If passed, only print matching files and do not delete")
-
-	cleanCmd.Flags().IntVarP(&cleanConfig.Concurrency, "concurrency", "c", 6, "Maximum number of simultaneous goroutines for API operations")
+	cleanCmd.Flags().BoolVar(&cleanConfig.Permanent, "permanent", false, "Delete permanently instead of moving to the trash")
+	cleanCmd.Flags().StringVar(&cleanConfig.Archive, "archive", "", "Export every tab of every matched spreadsheet before removing them: a directory, a .csv file, or a spreadsheet URL (or sheet:<id>) to append to")
+	cleanCmd.Flags().StringVar(&cleanConfig.ArchiveFormat, "archive-format", "csv", "File format when --archive is a directory: csv (a file per tab) or json (a file per spreadsheet)")
+	cleanCmd.Flags().BoolVarP(&cleanConfig.Yes, "yes", "y", false, "Don't ask for confirmation (required when stdin isn't a terminal, e.g. cron)")
+	cleanCmd.Flags().BoolVar(&cleanConfig.Yes, "force", false, "Same as --yes")
 }
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-ogle-sheets/api"
+)
+
+func TestArchiveNewDirNotSpreadsheet(t *testing.T) {
+	// Shaped just like a spreadsheet ID, but it's a directory to make
+	dest := filepath.Join(t.TempDir(), "weekly-turnout-archives-2025")
+	if _, ok := api.SpreadsheetIdFromString(filepath.Base(dest)); !ok {
+		t.Fatalf("Expected %q to look like a spreadsheet ID, or this test proves nothing", filepath.Base(dest))
+	}
+	if err := archive(context.Background(), &api.Client{}, dest, "csv", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stat, err := os.Stat(dest); err != nil || !stat.IsDir() {
+		t.Fatalf("Expected %s to be made as a directory, got %v", dest, err)
+	}
+	if err := archive(context.Background(), &api.Client{}, "sheet:nope", "csv", nil); err == nil {
+		t.Fatalf("Expected an error for sheet: without a spreadsheet ID")
+	}
+}
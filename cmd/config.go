@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go-ogle-sheets/conf"
+)
+
+// Flags that pick the config rather than being part of it
+var unconfigurableFlags = map[string]bool{
+	"help":    true,
+	"config":  true,
+	"profile": true,
+}
+
+// The config file resolveConfig last loaded, for the accounts section
+var configFile = &conf.File{}
+
+type resolvedSetting struct {
+	Name   string
+	Value  string
+	Source string
+}
+
+// resolveConfig fills every flag the user didn't pass on the command line,
+// in order of precedence: env var, then profile, then the top-level config
+// section, leaving the flag default alone if none of those are set. Values are
+// set on the flag directly so that Changed still means "passed by the user".
+func resolveConfig(cmd *cobra.Command) ([]resolvedSetting, error) {
+	file, err := conf.LoadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if profile != "" && !file.HasProfile(profile) {
+		return nil, fmt.Errorf("profile %q not found in config file %q", profile, file.Path)
+	}
+	configFile = file
+
+	var settings []resolvedSetting
+	var setErr error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if unconfigurableFlags[f.Name] || setErr != nil {
+			return
+		}
+		value, source := f.Value.String(), "default"
+		if f.Changed {
+			source = "flag"
+		} else if v, ok := os.LookupEnv(conf.EnvName(f.Name)); ok {
+			value, source = v, "env "+conf.EnvName(f.Name)
+		} else if v, src, ok := file.Lookup(profile, cmd.Name(), f.Name); ok {
+			value, source = v, src
+		}
+		if source != "default" && source != "flag" {
+			if err := f.Value.Set(value); err != nil {
+				setErr = fmt.Errorf("invalid value %q for %s (from %s): %w", value, f.Name, source, err)
+				return
+			}
+		}
+		settings = append(settings, resolvedSetting{Name: f.Name, Value: f.Value.String(), Source: source})
+	})
+	return settings, setErr
+}
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect turnout configuration",
+	Long:  `Inspect turnout configuration`,
+}
+
+// configShowCmd prints the settings each command would run with
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print resolved settings for each command",
+	Long: `Print the settings generate and clean would run with, and where each one came from.
+Precedence is flag > env (TURNOUT_<FLAG_NAME>) > profile > config file > default.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, c := range []*cobra.Command{generateCmd, cleanCmd} {
+			settings, err := resolveConfig(c)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			fmt.Fprintf(w, "%s:\n", c.Name())
+			for _, s := range settings {
+				fmt.Fprintf(w, "  %s\t%s\t(%s)\n", s.Name, s.Value, s.Source)
+			}
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd)
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+const testConfigYAML = `
+common:
+  title-template: "Turnout {{.Date}} #{{.Group}}"
+generate:
+  source: 1top
+  batch-size: 10
+  share-with: [a@example.org, b@example.org]
+profiles:
+  chapter-a:
+    generate:
+      source: 1chapterA
+`
+
+type resolveConfigTestConf struct {
+	profile string
+	args    []string
+	env     map[string]string
+	flag    string
+	value   string
+	source  string
+}
+
+var resolveConfigTests = []resolveConfigTestConf{
+	{"", nil, nil, "source", "1top", "turnout.yaml"},
+	{"", nil, nil, "dry-run", "false", "default"},
+	{"", nil, nil, "title-template", "Turnout {{.Date}} #{{.Group}}", "turnout.yaml"},
+	{"", nil, nil, "share-with", "[a@example.org,b@example.org]", "turnout.yaml"},
+	{"chapter-a", nil, nil, "source", "1chapterA", "profile chapter-a"},
+	{"chapter-a", nil, nil, "batch-size", "10", "turnout.yaml"},
+	{"chapter-a", nil, map[string]string{"TURNOUT_SOURCE": "1env"}, "source", "1env", "env TURNOUT_SOURCE"},
+	{"chapter-a", []string{"--source", "1flag"}, map[string]string{"TURNOUT_SOURCE": "1env"}, "source", "1flag", "flag"},
+	{"", []string{"--batch-size", "12"}, nil, "batch-size", "12", "flag"},
+	{"", nil, map[string]string{"TURNOUT_DRY_RUN": "true"}, "dry-run", "true", "env TURNOUT_DRY_RUN"},
+}
+
+// A stand-in for generate, so the real command's flags aren't touched
+func testGenerateCmd() *cobra.Command {
+	cmd := &cobra.Command{Use: "generate"}
+	cmd.Flags().String("source", "", "")
+	cmd.Flags().Int("batch-size", 5, "")
+	cmd.Flags().StringSlice("share-with", nil, "")
+	cmd.Flags().String("title-template", "default {{.Group}}", "")
+	cmd.Flags().Bool("dry-run", false, "")
+	return cmd
+}
+
+func TestResolveConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "turnout.yaml")
+	if err := os.WriteFile(path, []byte(testConfigYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+	oldPath, oldProfile := configPath, profile
+	defer func() { configPath, profile = oldPath, oldProfile }()
+	configPath = path
+
+	for _, test := range resolveConfigTests {
+		t.Run(test.flag, func(t *testing.T) {
+			for k, v := range test.env {
+				t.Setenv(k, v)
+			}
+			profile = test.profile
+			cmd := testGenerateCmd()
+			if err := cmd.ParseFlags(test.args); err != nil {
+				t.Fatal(err)
+			}
+			settings, err := resolveConfig(cmd)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for _, s := range settings {
+				if s.Name != test.flag {
+					continue
+				}
+				// Where it came from is the file's path, not just its name
+				source := s.Source
+				if source == path {
+					source = "turnout.yaml"
+				}
+				if s.Value != test.value || source != test.source {
+					t.Fatalf("Wrong %s in profile %q; expected %q from %q, got %q from %q", test.flag, test.profile, test.value, test.source, s.Value, source)
+				}
+				if test.source != "flag" && cmd.Flags().Changed(test.flag) {
+					t.Fatalf("Expected %s from %s to leave Changed alone", test.flag, test.source)
+				}
+				return
+			}
+			t.Fatalf("No setting for %s", test.flag)
+		})
+	}
+}
+
+func TestResolveConfigBadValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "turnout.yaml")
+	if err := os.WriteFile(path, []byte("generate:\n  batch-size: lots\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	oldPath, oldProfile := configPath, profile
+	defer func() { configPath, profile = oldPath, oldProfile }()
+	configPath, profile = path, ""
+	if _, err := resolveConfig(testGenerateCmd()); err == nil {
+		t.Fatalf("Expected an error for a batch-size that isn't a number")
+	}
+	profile = "nope"
+	if _, err := resolveConfig(testGenerateCmd()); err == nil {
+		t.Fatalf("Expected an error for a profile that isn't in the file")
+	}
+}
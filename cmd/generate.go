@@ -4,11 +4,13 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"encoding/json"
 	"github.com/spf13/cobra"
 	"go-ogle-sheets/api"
 	"go-ogle-sheets/conf"
 	"log"
-	"strconv"
+	"os"
+	"time"
 )
 
 var genConfig conf.GenerationConfig
@@ -19,7 +21,66 @@ var generateCmd = &cobra.Command{
 	Short: "Main function: generate turnout sheets",
 	Long:  `Generate turnout sheets 10 at a time based on the source sheet`,
 	Run: func(cmd *cobra.Command, args []string) {
-		err := api.GenerateAllBatches(genConfig)
+		// Required flags are checked here rather than by cobra so they can come from env or config
+		if err := genConfig.Validate(); err != nil {
+			log.Fatalf("Invalid configuration:\n%v", err)
+		}
+		if err := genConfig.ResolveDates(time.Now()); err != nil {
+			log.Fatalf("Invalid date: %v", err)
+		}
+		if genConfig.TemplateSpreadsheetId != "" {
+			id, ok := api.SpreadsheetIdFromString(genConfig.TemplateSpreadsheetId)
+			if !ok {
+				log.Fatalf("Invalid configuration:\ntemplate-spreadsheet: %q isn't a spreadsheet URL or ID", genConfig.TemplateSpreadsheetId)
+			}
+			genConfig.TemplateSpreadsheetId = id
+		}
+		log.Printf("Generating for %s (%s)", genConfig.EventDate.Format("Monday, January 2, 2006"), genConfig.Date)
+		ctx := cmd.Context()
+		// The source can be read as a different account than creates the batches
+		var client, reader *api.Client
+		var err error
+		if !genConfig.DryRun {
+			client, err = api.NewClient(ctx, authConfig, api.GenerateScopes(genConfig)...)
+			if err != nil {
+				log.Fatalf("Failed to initialize Google API client: %v", err)
+			}
+			reader = client
+		}
+		if reader == nil || (genConfig.SourceAccount != "" && genConfig.SourceAccount != authConfig.Account) {
+			sourceAuth := authConfig
+			if genConfig.SourceAccount != "" {
+				if sourceAuth, err = accountAuth(genConfig.SourceAccount); err != nil {
+					log.Fatalf("Invalid source account: %v", err)
+				}
+			}
+			reader, err = api.NewClient(ctx, sourceAuth, api.SourceScopes...)
+			if err != nil {
+				log.Fatalf("Failed to initialize Google API client for reading the source: %v", err)
+			}
+		}
+		// Real runs execute the same plan a dry run would print. Reading the
+		// source gets the same time limit as one batch
+		planCtx, cancel := withTimeout(ctx, genConfig.Timeout)
+		plan, err := reader.GeneratePlan(planCtx, genConfig)
+		cancel()
+		if err != nil {
+			log.Fatalf("Failed to plan spreadsheets: %v", err)
+		}
+		if genConfig.DryRun {
+			if genConfig.Output == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				err = enc.Encode(plan)
+			} else {
+				err = plan.WriteTable(os.Stdout)
+			}
+			if err != nil {
+				log.Fatalf("Failed to print plan: %v", err)
+			}
+			return
+		}
+		err = client.ExecutePlan(ctx, genConfig, plan)
 		if err != nil {
 			log.Fatalf("Failed to create spreadsheets: %v", err)
 		}
@@ -29,26 +90,36 @@ var generateCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(generateCmd)
 
-	// Main flags (should not ship with default ids embedded obv)
-	generateCmd.Flags().StringVarP(&genConfig.Date, "date", "d", "", "Date for created spreadsheet titles")
-	generateCmd.MarkFlagRequired("date")
-
-	generateCmd.Flags().StringVarP(&genConfig.TurnoutSourceId, "source", "s", "15bc-ViIr9Q1tP3xKpl79wGyVmr1UsBlQSrv_GkVVEzA", "ID of source spreadsheet")
-
-	// Need int64 for this flag
-	var templateSheetIdStr string
-	generateCmd.Flags().StringVarP(&templateSheetIdStr, "template-sheet", "t", "1625421409", "ID of template sheet in source spreadsheet")
-	templateSheetId, err := strconv.ParseInt(templateSheetIdStr, 10, 64)
-	if err != nil {
-		log.Fatalf("Could not convert %s to int64: %v", templateSheetIdStr, err)
-	}
-	genConfig.TemplateSheetId = templateSheetId
+	// Main flags. Document IDs live in turnout.yaml (or env) rather than being baked in here
+	generateCmd.Flags().StringVarP(&genConfig.Date, "date", "d", "", "Date for created spreadsheet titles, e.g. 2025-01-05, 1/5, Jan 5, today, +7d or next thursday (required)")
+	generateCmd.Flags().StringVar(&genConfig.DateLayout, "date-layout", conf.DefaultDateLayout, "Go time layout for writing the date into titles")
+	generateCmd.Flags().StringVarP(&genConfig.TurnoutSourceId, "source", "s", "", "ID of source spreadsheet (required)")
+	generateCmd.Flags().StringVar(&genConfig.SourceAccount, "source-account", "", "Account to read the source as (default --account); batches are still created as --account, which needs read access to the template")
+	generateCmd.Flags().Int64VarP(&genConfig.TemplateSheetId, "template-sheet", "t", conf.NoTemplateSheet, "ID of template sheet in source spreadsheet, the gid= in its URL (required unless --template-spreadsheet)")
+	generateCmd.Flags().StringVar(&genConfig.TemplateSpreadsheetId, "template-spreadsheet", "", "URL or ID of a whole spreadsheet to copy for each batch, instead of one --template-sheet tab")
+	generateCmd.MarkFlagsMutuallyExclusive("template-sheet", "template-spreadsheet")
+	generateCmd.Flags().StringVar(&genConfig.TargetRange, "target-range", "Sheet1!A2", "Tab and cell where contacts start in each batch (with --template-sheet the tab is renamed to match), or a named range in the --template-spreadsheet")
+	generateCmd.Flags().StringSliceVar(&genConfig.Columns, "columns", conf.DefaultColumns, "What goes in each column from --target-range on: name, phone, message, status, or - to leave a template column alone")
+	generateCmd.Flags().StringVar(&genConfig.ValueInput, "value-input", conf.ValueInputRaw, "How cells are written: raw (exactly as in the source) or user-entered (parsed as if typed, so numbers and formulas work)")
+	generateCmd.Flags().BoolVar(&genConfig.FreezeHeader, "freeze-header", false, "Freeze the rows above --target-range so the header stays put while scrolling")
+	generateCmd.Flags().BoolVar(&genConfig.ProtectContacts, "protect-contacts", false, "Make editing the name and phone columns ask \"are you sure?\" first")
+	generateCmd.Flags().StringVar(&genConfig.MessageTemplate, "message-template", "", "Go template for a message to each contact, written to the message column and prefilled in sms links; fields are .FirstName, .Phone, .Row, .Date, .EventDate, .Volunteer, .Group, .GroupKey")
+	generateCmd.Flags().StringVar(&genConfig.MessageTemplateRange, "message-template-range", "", "Cell of the source spreadsheet holding the --message-template instead, e.g. 'messages!A1'")
+	generateCmd.MarkFlagsMutuallyExclusive("message-template", "message-template-range")
+	generateCmd.Flags().StringVar(&genConfig.PhoneLinks, "phone-links", conf.PhoneLinksNone, "Write phone numbers as tap-to-call (tel) or tap-to-text (sms) links, or plain (none); links need --value-input user-entered")
 
 	generateCmd.Flags().IntVar(&genConfig.DoTurnoutIdx, "do-turnout-idx", 0, "Relative Index of Do Turnout field (default 0)")
 	generateCmd.Flags().IntVar(&genConfig.FirstNameIdx, "first-name-idx", 1, "Relative Index of First Name field (default 1)")
 	generateCmd.Flags().IntVar(&genConfig.PhoneIdx, "phone-idx", 3, "Relative Index of Phone Number field (default 3)")
+	generateCmd.Flags().IntVar(&genConfig.GroupIdx, "group-idx", conf.NoGroupIdx, "Relative Index of a field (e.g. precinct) to batch contacts by, so no batch mixes two values; the value is .GroupKey in titles")
 	generateCmd.Flags().IntVar(&genConfig.BatchSize, "batch-size", 10, "Number of records per batch (default 10)")
 	generateCmd.Flags().IntVar(&genConfig.LastPageFudgeFactor, "last-page-fudge", 3, "Maximum number of records to append to last batch (default 3)")
 	generateCmd.Flags().StringVarP(&genConfig.TurnoutReadRange, "read-range", "r", "turnout-list!B2:E", "A1-style read range to pull from source spreadsheet")
+	generateCmd.Flags().StringVar(&genConfig.TitleTemplate, "title-template", conf.DefaultTitleTemplate, "Go template for spreadsheet titles; fields are .Date, .Group, .Volunteer, .GroupKey, .Count, .Total")
+	generateCmd.Flags().StringSliceVar(&genConfig.Volunteers, "volunteers", nil, "Volunteers to assign batches to round-robin, as emails or \"Name <email>\"; each is shared on their batch")
+	generateCmd.Flags().StringSliceVar(&genConfig.ShareWith, "share-with", nil, "Emails to share every batch with")
+	generateCmd.Flags().BoolVarP(&genConfig.DryRun, "dry-run", "n", false, "Read the source and print the plan without creating anything")
+	generateCmd.Flags().StringVarP(&genConfig.Output, "output", "o", "table", "Format for --dry-run plan: table or json")
 	generateCmd.Flags().IntVarP(&genConfig.Concurrency, "concurrency", "c", 6, "Maximum number of simultaneous goroutines for API operations")
+	generateCmd.Flags().DurationVar(&genConfig.Timeout, "timeout", 2*time.Minute, "Give up on reading the source, or on (and roll back) a batch, after this long; 0 for no limit")
 }
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"go-ogle-sheets/api"
+	"go-ogle-sheets/conf"
+	"go-ogle-sheets/util"
+	"log"
+	"time"
+)
+
+var restoreConfig conf.CleanConfig
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Bring cleaned turnout sheets back out of the trash",
+	Long: `Bring cleaned turnout sheets back out of the trash. Takes the same
+--date, --since/--until, --match and --q options as clean.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := restoreConfig.Validate(); err != nil {
+			log.Fatalf("Invalid configuration:\n%v", err)
+		}
+		if err := restoreConfig.ResolveDates(time.Now()); err != nil {
+			log.Fatalf("Invalid date: %v", err)
+		}
+		ctx := cmd.Context()
+		client, err := api.NewClient(ctx, authConfig, api.CleanScopes(restoreConfig)...)
+		if err != nil {
+			log.Fatalf("Failed to initialize Google API client: %v", err)
+		}
+
+		searchCtx, cancel := withTimeout(ctx, restoreConfig.Timeout)
+		driveFiles, err := client.FindSpreadsheets(searchCtx, searchBase(restoreConfig, true), restoreConfig)
+		cancel()
+		if err != nil {
+			log.Fatalf("Failed to get trashed spreadsheets: %v", err)
+		}
+		if len(driveFiles) == 0 {
+			fmt.Println("Found no matches in the trash.")
+			return
+		}
+		fmt.Printf("Found %d matches in the trash:\n", len(driveFiles))
+		tableCtx, cancel := withTimeout(ctx, restoreConfig.Timeout)
+		printFileTable(tableCtx, client, driveFiles)
+		cancel()
+		if restoreConfig.Test {
+			return
+		}
+
+		errs := util.RunConcurrently(len(driveFiles), restoreConfig.Concurrency, func(i int) error {
+			opCtx, cancel := withTimeout(ctx, restoreConfig.Timeout)
+			defer cancel()
+			err := client.RestoreSpreadsheet(opCtx, driveFiles[i].Id)
+			if err != nil {
+				log.Printf("Error while restoring spreadsheet %s: %v", driveFiles[i].Id, err)
+			}
+			return err
+		})
+		if len(errs) > 0 {
+			log.Fatalf("Got errors while concurrently restoring! %v", errs)
+		}
+		fmt.Printf("Restored %d spreadsheets\n", len(driveFiles))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+
+	addSearchFlags(restoreCmd, &restoreConfig)
+	restoreCmd.Flags().BoolVarP(&restoreConfig.Test, "test", "t", false, "If passed, only print matching files and do not restore")
+}
@@ -1,17 +1,44 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"go-ogle-sheets/api"
+	"go-ogle-sheets/conf"
 )
 
+// Settings shared by every command
+var configPath string
+var profile string
+// Auth settings from the flags, and those with --account's settings on top
+var authFlags conf.AuthConfig
+var authConfig conf.AuthConfig
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "turnout",
 	Short: "Hit Google Sheets API to generate turnout spreadsheets",
 	Long: `Hit Google Sheets API to generate turnout spreadsheets`,
+	Version: api.Version,
+	// Fill in any flags the user didn't pass from env vars and the config file
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		_, err := resolveConfig(cmd)
+		// Env only, so it doesn't end up in shell history or config files
+		authFlags.TokenPassphrase = os.Getenv("TURNOUT_TOKEN_PASSPHRASE")
+		if err == nil {
+			authConfig, err = accountAuth(authFlags.Account)
+		}
+		if err != nil {
+			cmd.SilenceUsage = true // it's not a usage problem
+		}
+		return err
+	},
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
@@ -20,12 +47,42 @@ var rootCmd = &cobra.Command{
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	err := rootCmd.Execute()
+	// Ctrl-c (or a SIGTERM from cron/systemd) cancels whatever's in flight, and
+	// generate rolls back half-made batches. A second one kills us outright.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
 
+// withTimeout bounds one operation by --timeout, if there is one
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// accountAuth is the auth settings for a named account from the config file
+// (or the flags alone for ""), so commands can act as more than one account.
+func accountAuth(name string) (conf.AuthConfig, error) {
+	return configFile.AccountAuth(name, profile, authFlags)
+}
+
 func init() {
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", os.Getenv("TURNOUT_CONFIG"), "Config file (default ./turnout.yaml, then $XDG_CONFIG_HOME/turnout/config.yaml)")
+	rootCmd.PersistentFlags().StringVarP(&profile, "profile", "p", os.Getenv("TURNOUT_PROFILE"), "Named profile from the config file")
+	rootCmd.PersistentFlags().BoolVar(&api.Verbose, "verbose", false, "Log more, like how many API calls each batch took")
+	rootCmd.PersistentFlags().StringVar(&authFlags.Account, "account", "", "Named account from the config file's accounts section to act as")
+	rootCmd.PersistentFlags().StringVar(&authFlags.CredentialsFile, "credentials", "", "OAuth client or service account key JSON (default ./credentials.json, then Application Default Credentials)")
+	rootCmd.PersistentFlags().StringVar(&authFlags.TokenStore, "token-store", api.TokenStoreFile, "Where to keep your sign-in token: file, encrypted (needs --token-key-file or TURNOUT_TOKEN_PASSPHRASE) or memory (sign in every run)")
+	rootCmd.PersistentFlags().StringVar(&authFlags.TokenKeyFile, "token-key-file", "", "Key file for --token-store encrypted")
+	rootCmd.PersistentFlags().StringVar(&authFlags.Impersonate, "impersonate", "", "User for a service account to act as (needs domain-wide delegation)")
 }
@@ -0,0 +1,98 @@
+package conf
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A1Range is a parsed A1-notation range like "turnout-list!B2:E". Columns and
+// rows are 1-based; zero means the range is open on that side (e.g. "B2:E" has
+// no EndRow, "A:D" has no rows at all).
+type A1Range struct {
+	Sheet    string
+	StartCol int
+	StartRow int
+	EndCol   int
+	EndRow   int
+}
+
+// Sheets stops at column ZZZ, so anything with more letters is a sheet name
+// ("Sheet1", "contacts"), not a cell
+var a1CellPattern = regexp.MustCompile(`^([A-Za-z]{0,3})([0-9]*)$`)
+
+// ParseA1Range parses the A1 notation the Sheets API accepts: an optional
+// sheet name (quoted if it has spaces or punctuation), then a cell or a
+// cell:cell range. A bare sheet name means the whole sheet.
+func ParseA1Range(s string) (A1Range, error) {
+	var r A1Range
+	if s == "" {
+		return r, fmt.Errorf("empty range")
+	}
+	cells := s
+	if i := strings.LastIndex(s, "!"); i >= 0 {
+		r.Sheet, cells = s[:i], s[i+1:]
+		if strings.HasPrefix(r.Sheet, "'") {
+			if len(r.Sheet) < 2 || !strings.HasSuffix(r.Sheet, "'") {
+				return r, fmt.Errorf("unterminated quote in sheet name %s", r.Sheet)
+			}
+			r.Sheet = strings.ReplaceAll(r.Sheet[1:len(r.Sheet)-1], "''", "'")
+		}
+		if r.Sheet == "" {
+			return r, fmt.Errorf("empty sheet name in %q", s)
+		}
+		if cells == "" {
+			return r, fmt.Errorf("nothing after '!' in %q", s)
+		}
+	} else if !strings.Contains(s, ":") && !a1CellPattern.MatchString(s) {
+		// Just a sheet name
+		r.Sheet = s
+		return r, nil
+	}
+
+	start, end, isRange := strings.Cut(cells, ":")
+	var err error
+	if r.StartCol, r.StartRow, err = parseA1Cell(start); err != nil {
+		return r, err
+	}
+	if !isRange {
+		r.EndCol, r.EndRow = r.StartCol, r.StartRow
+		return r, nil
+	}
+	if r.EndCol, r.EndRow, err = parseA1Cell(end); err != nil {
+		return r, err
+	}
+	if r.StartCol > 0 && r.EndCol > 0 && r.EndCol < r.StartCol {
+		return r, fmt.Errorf("range %q ends before it starts", s)
+	}
+	if r.StartRow > 0 && r.EndRow > 0 && r.EndRow < r.StartRow {
+		return r, fmt.Errorf("range %q ends before it starts", s)
+	}
+	return r, nil
+}
+
+func parseA1Cell(cell string) (col int, row int, err error) {
+	m := a1CellPattern.FindStringSubmatch(cell)
+	if m == nil || cell == "" {
+		return 0, 0, fmt.Errorf("%q is not an A1 cell reference", cell)
+	}
+	for _, c := range strings.ToUpper(m[1]) {
+		col = col*26 + int(c-'A'+1)
+	}
+	if m[2] != "" {
+		row, err = strconv.Atoi(m[2])
+		if err != nil || row == 0 {
+			return 0, 0, fmt.Errorf("%q has an invalid row number", cell)
+		}
+	}
+	return col, row, nil
+}
+
+// Width is the number of columns in the range, or 0 if it's open-ended.
+func (r A1Range) Width() int {
+	if r.StartCol == 0 || r.EndCol == 0 {
+		return 0
+	}
+	return r.EndCol - r.StartCol + 1
+}
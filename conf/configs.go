@@ -1,22 +1,131 @@
 package conf
 
+import (
+	"time"
+)
+
+// AuthConfig says how to authenticate with Google. It's shared by every
+// command that talks to the API.
+type AuthConfig struct {
+	Account string // Name from the config's accounts section, or "" for the default
+	CredentialsFile string // OAuth client, service account key, or other credentials JSON
+	Impersonate string // User a service account acts as, via domain-wide delegation
+	TokenFile string // Where a signed-in user's token is kept; see TokenPath
+	TokenStore string // file, encrypted or memory
+	TokenKeyFile string // Key for the encrypted store
+	TokenPassphrase string // Or a passphrase for it, from TURNOUT_TOKEN_PASSPHRASE
+}
+
 type GenerationConfig struct {
 	Date string
+	DateLayout string
+	EventDate time.Time // Date, parsed. Set by ResolveDates
 	TurnoutSourceId string
+	SourceAccount string // Account to read the source as, if not the one creating batches
 	TurnoutReadRange string
-	TemplateSheetId int64
+	TemplateSheetId int64 // NoTemplateSheet unless set
+	TemplateSpreadsheetId string // Copy this whole spreadsheet for each batch instead of one tab
+	TargetRange string // Tab and cell the contacts are written to, e.g. "Contacts!B4", or a named range
+	Columns []string // What goes in each column from the target on; see ColumnName etc.
+	ValueInput string // raw or user-entered
+	PhoneLinks string // none, tel or sms
+	MessageTemplate string // Go template for a message to each contact; see MessageData
+	MessageTemplateRange string // Or a cell of the source spreadsheet holding one
+	FreezeHeader bool // Freeze the rows above the target
+	ProtectContacts bool // Warn before anyone edits the name and phone columns
 	DoTurnoutIdx int
 	FirstNameIdx int
 	PhoneIdx int
+	GroupIdx int // Column whose value contacts are batched by, or NoGroupIdx
 	BatchSize int
 	LastPageFudgeFactor int
 	Concurrency int
+	Timeout time.Duration // Per batch; 0 for none
+	TitleTemplate string
+	Volunteers []string // "Name <email>" or just an email; batches are dealt out round-robin
+	ShareWith []string // Emails every batch gets shared with
+	DryRun bool
+	Output string // Plan format for dry runs: table or json
 }
 
 type CleanConfig struct {
 	Date string
+	DateLayout string
+	EventDate time.Time
+	Since string
+	Until string
+	SinceDate time.Time // Zero if open-ended
+	UntilDate time.Time
+	OlderThan string // Age like "8w"; only match spreadsheets created before then
+	Cutoff time.Time // OlderThan, resolved
+	Archive string // Where to export spreadsheet contents before removing them
+	ArchiveFormat string // csv or json, for directory archives
+	TitleTemplate string
 	MatchPattern string
 	Q string
 	Test bool
+	Permanent bool // Delete outright instead of moving to the trash
+	Yes bool // Don't ask for confirmation
+	IncludeUnmanaged bool // Also match spreadsheets generate didn't stamp
 	Concurrency int
+	Timeout time.Duration // Per search and per file removed or restored; 0 for none
+}
+
+// ResolveDates parses Date into EventDate and rewrites Date in DateLayout, so
+// "Jan 5", "2025-01-05" and "1/5" all give the same titles. Call it after
+// Validate.
+func (c *GenerationConfig) ResolveDates(now time.Time) error {
+	t, err := ParseDate(c.Date, now)
+	if err != nil {
+		return err
+	}
+	c.EventDate = t
+	c.Date = t.Format(c.DateLayout)
+	return nil
+}
+
+// ResolveDates does the same for clean's --date, --since and --until.
+func (c *CleanConfig) ResolveDates(now time.Time) error {
+	var err error
+	if c.Date != "" {
+		if c.EventDate, err = ParseDate(c.Date, now); err != nil {
+			return err
+		}
+		c.Date = c.EventDate.Format(c.DateLayout)
+	}
+	if c.Since != "" {
+		if c.SinceDate, err = ParseDate(c.Since, now); err != nil {
+			return err
+		}
+	}
+	if c.Until != "" {
+		if c.UntilDate, err = ParseDate(c.Until, now); err != nil {
+			return err
+		}
+	}
+	if c.OlderThan != "" {
+		days, err := ParseAge(c.OlderThan)
+		if err != nil {
+			return err
+		}
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+		c.Cutoff = today.AddDate(0, 0, -days)
+	}
+	return nil
+}
+
+// InRange reports whether t falls between --since and --until, inclusive.
+func (c CleanConfig) InRange(t time.Time) bool {
+	if !c.SinceDate.IsZero() && t.Before(c.SinceDate) {
+		return false
+	}
+	if !c.UntilDate.IsZero() && t.After(c.UntilDate) {
+		return false
+	}
+	return true
+}
+
+// IsRange reports whether clean was asked for a date range rather than a single date.
+func (c CleanConfig) IsRange() bool {
+	return c.Since != "" || c.Until != ""
 }
@@ -0,0 +1,168 @@
+package conf
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDateLayout is how dates show up in titles unless --date-layout says
+// otherwise. It's what we were typing by hand before dates were parsed.
+const DefaultDateLayout = "1/2"
+
+// Layouts we accept for absolute dates. Ones without a year get whichever year
+// puts them closest to the reference date.
+var inputLayouts = []string{
+	"2006-01-02",
+	"1/2/2006",
+	"1/2/06",
+	"1/2",
+	"1-2",
+	"Jan 2 2006",
+	"Jan 2, 2006",
+	"January 2 2006",
+	"January 2, 2006",
+	"Jan 2",
+	"January 2",
+	"2 Jan 2006",
+	"2 Jan",
+	"Mon Jan 2",
+	"Monday Jan 2",
+	"Monday, January 2",
+}
+
+var relativePattern = regexp.MustCompile(`^([+-])(\d+)([dw])$`)
+var agePattern = regexp.MustCompile(`^(\d+)([dw])$`)
+
+// ParseDate understands absolute dates in a handful of common layouts, plus
+// "today", "tomorrow", "yesterday", offsets like "+7d" or "-2w", and weekdays
+// ("thursday" or "this thursday" is today or the coming one, "next thursday"
+// is strictly after today, "last thursday" strictly before). The result is
+// midnight local time.
+func ParseDate(s string, now time.Time) (time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	input := strings.ToLower(strings.Join(strings.Fields(s), " "))
+
+	switch input {
+	case "":
+		return time.Time{}, fmt.Errorf("empty date")
+	case "today":
+		return today, nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	}
+
+	if m := relativePattern.FindStringSubmatch(input); m != nil {
+		n, err := strconv.Atoi(m[2])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("bad offset %q: %w", s, err)
+		}
+		if m[1] == "-" {
+			n = -n
+		}
+		if m[3] == "w" {
+			n *= 7
+		}
+		return today.AddDate(0, 0, n), nil
+	}
+
+	if t, ok := parseWeekday(input, today); ok {
+		return t, nil
+	}
+
+	if t, err := ParseDateLayout(strings.Join(strings.Fields(s), " "), inputLayouts, today); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("can't understand date %q; try something like 2025-01-05, 1/5, Jan 5, today, +7d or next thursday", s)
+}
+
+func parseWeekday(input string, today time.Time) (time.Time, bool) {
+	modifier, day, found := strings.Cut(input, " ")
+	if !found {
+		modifier, day = "this", input
+	}
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		name := strings.ToLower(wd.String())
+		if day != name && day != name[:3] {
+			continue
+		}
+		ahead := (int(wd) - int(today.Weekday()) + 7) % 7
+		switch modifier {
+		case "this":
+			return today.AddDate(0, 0, ahead), true
+		case "next":
+			if ahead == 0 {
+				ahead = 7
+			}
+			return today.AddDate(0, 0, ahead), true
+		case "last":
+			behind := (int(today.Weekday()) - int(wd) + 7) % 7
+			if behind == 0 {
+				behind = 7
+			}
+			return today.AddDate(0, 0, -behind), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ParseDateLayout tries each layout in turn. If the winning layout has no
+// year, we pick the year that lands closest to reference, so "12/30" typed in
+// January means last month rather than next December.
+func ParseDateLayout(s string, layouts []string, reference time.Time) (time.Time, error) {
+	var lastErr error
+	for _, layout := range layouts {
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if t.Year() == 0 {
+			t = closestYear(t, reference)
+		}
+		return t, nil
+	}
+	return time.Time{}, lastErr
+}
+
+func closestYear(t time.Time, reference time.Time) time.Time {
+	best := time.Time{}
+	for _, year := range []int{reference.Year() - 1, reference.Year(), reference.Year() + 1} {
+		candidate := time.Date(year, t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+		// Feb 29 would roll over into March in a non-leap year
+		if candidate.Day() != t.Day() {
+			continue
+		}
+		if best.IsZero() || absDuration(candidate.Sub(reference)) < absDuration(best.Sub(reference)) {
+			best = candidate
+		}
+	}
+	return best
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// ParseAge turns an age like "30d" or "8w" into a number of days.
+func ParseAge(s string) (int, error) {
+	m := agePattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if m == nil {
+		return 0, fmt.Errorf("can't understand age %q; use days or weeks, like 30d or 8w", s)
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, fmt.Errorf("bad age %q: %w", s, err)
+	}
+	if m[2] == "w" {
+		n *= 7
+	}
+	return n, nil
+}
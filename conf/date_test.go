@@ -0,0 +1,86 @@
+package conf
+
+import (
+	"testing"
+	"time"
+)
+
+type dateTestConf struct {
+	given    string
+	expected string // 2006-01-02, or "" for an error
+}
+
+// Relative to Thursday, January 9th 2025
+var dateTests = []dateTestConf{
+	{"today", "2025-01-09"},
+	{"Tomorrow", "2025-01-10"},
+	{"yesterday", "2025-01-08"},
+	{"+7d", "2025-01-16"},
+	{"-2w", "2024-12-26"},
+	{"thursday", "2025-01-09"},
+	{"this thu", "2025-01-09"},
+	{"next thursday", "2025-01-16"},
+	{"next  Friday", "2025-01-10"},
+	{"last thursday", "2025-01-02"},
+	{"last monday", "2025-01-06"},
+	{"2025-01-05", "2025-01-05"},
+	{"1/5", "2025-01-05"},
+	{"1/5/2025", "2025-01-05"},
+	{"Jan 5", "2025-01-05"},
+	{"January 5, 2025", "2025-01-05"},
+	{"12/30", "2024-12-30"},
+	{"2/29", "2024-02-29"},
+	{"", ""},
+	{"someday", ""},
+	{"13/45", ""},
+	{"+7y", ""},
+}
+
+func TestParseDate(t *testing.T) {
+	now := time.Date(2025, time.January, 9, 15, 4, 5, 0, time.Local)
+	for _, test := range dateTests {
+		actual, err := ParseDate(test.given, now)
+		if test.expected == "" {
+			if err == nil {
+				t.Fatalf("Expected error parsing %q, got %v", test.given, actual)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error parsing %q: %v", test.given, err)
+		}
+		if actual.Format("2006-01-02") != test.expected {
+			t.Fatalf("Wrong date for %q; expected %s, got %s", test.given, test.expected, actual.Format("2006-01-02"))
+		}
+		if actual.Hour() != 0 || actual.Minute() != 0 {
+			t.Fatalf("Expected midnight for %q, got %v", test.given, actual)
+		}
+	}
+}
+
+func TestDateNormalization(t *testing.T) {
+	now := time.Date(2025, time.January, 9, 0, 0, 0, 0, time.Local)
+	for _, given := range []string{"1/5", "2025-01-05", "Jan 5", "last sunday"} {
+		c := GenerationConfig{Date: given, DateLayout: DefaultDateLayout}
+		if err := c.ResolveDates(now); err != nil {
+			t.Fatalf("Unexpected error resolving %q: %v", given, err)
+		}
+		if c.Date != "1/5" {
+			t.Fatalf("Wrong normalized date for %q; expected 1/5, got %s", given, c.Date)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	for given, expected := range map[string]int{"30d": 30, "8w": 56, " 2W ": 14, "0d": 0} {
+		actual, err := ParseAge(given)
+		if err != nil || actual != expected {
+			t.Fatalf("Wrong age for %q; expected %d, got %d (%v)", given, expected, actual, err)
+		}
+	}
+	for _, given := range []string{"", "8", "-8w", "2m", "w"} {
+		if _, err := ParseAge(given); err == nil {
+			t.Fatalf("Expected error parsing age %q", given)
+		}
+	}
+}
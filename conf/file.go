@@ -0,0 +1,193 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Section holds settings for one command, keyed by the same names as its flags
+// (e.g. "batch-size", "read-range"). Anything you can pass on the command line
+// can live here.
+type Section map[string]interface{}
+
+// File is the parsed turnout.yaml. Top-level keys are command names, plus
+// "common" for settings shared by every command that has the flag (like
+// title-template, which generate and clean must agree on). Profiles hold the
+// same shape and are layered on top when selected with --profile.
+//
+//	common:
+//	  title-template: "Turnout {{.Date}} #{{.Group}}"
+//	generate:
+//	  source: 1abc...
+//	  batch-size: 10
+//	profiles:
+//	  chapter-a:
+//	    common:
+//	      account: chapter-a
+//	    generate:
+//	      source: 1xyz...
+//	accounts:
+//	  chapter-a:
+//	    credentials: chapter-a-credentials.json
+//
+// Accounts are named Google identities, each with its own credentials and
+// token, picked with --account (or an account setting like above).
+type File struct {
+	Path     string                        `yaml:"-"`
+	Commands map[string]Section            `yaml:",inline"`
+	Profiles map[string]map[string]Section `yaml:"profiles"`
+	Accounts map[string]Section            `yaml:"accounts"`
+}
+
+// ConfigSearchPaths lists the places we look for a config file, in order.
+func ConfigSearchPaths() []string {
+	paths := []string{"turnout.yaml"}
+	if dir := ConfigDir(); dir != "" {
+		paths = append(paths, filepath.Join(dir, "config.yaml"))
+	}
+	return paths
+}
+
+// ConfigDir is $XDG_CONFIG_HOME/turnout, falling back to ~/.config/turnout.
+func ConfigDir() string {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		base = filepath.Join(home, ".config")
+	}
+	return filepath.Join(base, "turnout")
+}
+
+// TokenPath is where the signed-in token lives. A named account has its own
+// wherever it's used; otherwise each profile gets one, so a profile can be a
+// different Google account without setting up accounts. No profile is
+// "default".
+func TokenPath(profile string, account string) string {
+	name := profile
+	if name == "" {
+		name = "default"
+	}
+	if account != "" {
+		name = filepath.Join("accounts", account)
+	}
+	dir := ConfigDir()
+	if dir == "" {
+		return strings.ReplaceAll(name, string(filepath.Separator), "-") + "-token.json"
+	}
+	return filepath.Join(dir, "tokens", name+".json")
+}
+
+// LoadFile reads the config at path, or the first file found in
+// ConfigSearchPaths if path is empty. Finding nothing is not an error; you just
+// get an empty File.
+func LoadFile(path string) (*File, error) {
+	if path != "" {
+		return readFile(path)
+	}
+	for _, p := range ConfigSearchPaths() {
+		f, err := readFile(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		return f, err
+	}
+	return &File{}, nil
+}
+
+func readFile(path string) (*File, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{Path: path}
+	if err := yaml.Unmarshal(b, f); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// CommonSection holds settings that apply to every command.
+const CommonSection = "common"
+
+// Lookup returns the configured value for a command's setting. The profile
+// wins over the top level, and within each the command's own section wins
+// over the common one; source says where it came from.
+func (f *File) Lookup(profile string, command string, key string) (value string, source string, ok bool) {
+	if profile != "" {
+		for _, section := range []string{command, CommonSection} {
+			if v, ok := f.Profiles[profile][section][key]; ok {
+				return stringify(v), "profile " + profile, true
+			}
+		}
+	}
+	for _, section := range []string{command, CommonSection} {
+		if v, ok := f.Commands[section][key]; ok {
+			return stringify(v), f.Path, true
+		}
+	}
+	return "", "", false
+}
+
+// AccountAuth layers the named account's settings over base. Settings the
+// account has win, since picking an account is picking its credentials; the
+// rest come from base. No name gives back base with the profile's token.
+func (f *File) AccountAuth(name string, profile string, base AuthConfig) (AuthConfig, error) {
+	auth := base
+	auth.Account = name
+	auth.TokenFile = TokenPath(profile, name)
+	if name == "" {
+		return auth, nil
+	}
+	section, ok := f.Accounts[name]
+	if !ok {
+		return auth, fmt.Errorf("account %q not found in config file %q", name, f.Path)
+	}
+	for key, v := range section {
+		value := stringify(v)
+		switch key {
+		case "credentials":
+			auth.CredentialsFile = value
+		case "impersonate":
+			auth.Impersonate = value
+		case "token-store":
+			auth.TokenStore = value
+		case "token-key-file":
+			auth.TokenKeyFile = value
+		default:
+			return auth, fmt.Errorf("account %q: unknown setting %q (use credentials, impersonate, token-store or token-key-file)", name, key)
+		}
+	}
+	return auth, nil
+}
+
+// HasProfile reports whether the named profile exists in the file.
+func (f *File) HasProfile(profile string) bool {
+	_, ok := f.Profiles[profile]
+	return ok
+}
+
+// Lists are joined with commas so they can be handed to slice-valued flags.
+func stringify(v interface{}) string {
+	if list, ok := v.([]interface{}); ok {
+		parts := make([]string, len(list))
+		for i, item := range list {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(v)
+}
+
+// EnvName is the environment variable that overrides a given setting, e.g.
+// batch-size -> TURNOUT_BATCH_SIZE.
+func EnvName(key string) string {
+	return "TURNOUT_" + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
@@ -0,0 +1,109 @@
+package conf
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type accountAuthTestConf struct {
+	name     string
+	expected AuthConfig
+	err      string
+}
+
+var testAccountsFile = &File{Path: "turnout.yaml", Accounts: map[string]Section{
+	"chapter-a": {"credentials": "a.json", "token-store": "encrypted"},
+	"chapter-b": {"credentials": "b-key.json", "impersonate": "organizer@b.org"},
+	"typo":      {"credential": "c.json"},
+}}
+
+var accountAuthTests = []accountAuthTestConf{
+	{"", AuthConfig{CredentialsFile: "base.json", TokenFile: TokenPath("p", "")}, ""},
+	{"chapter-a", AuthConfig{Account: "chapter-a", CredentialsFile: "a.json", TokenStore: "encrypted", TokenFile: TokenPath("p", "chapter-a")}, ""},
+	{"chapter-b", AuthConfig{Account: "chapter-b", CredentialsFile: "b-key.json", Impersonate: "organizer@b.org", TokenFile: TokenPath("p", "chapter-b")}, ""},
+	{"chapter-c", AuthConfig{}, "not found"},
+	{"typo", AuthConfig{}, "unknown setting"},
+}
+
+func TestAccountAuth(t *testing.T) {
+	base := AuthConfig{CredentialsFile: "base.json"}
+	for _, test := range accountAuthTests {
+		actual, err := testAccountsFile.AccountAuth(test.name, "p", base)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("Wrong error for account %q; expected %v, got %v", test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil || actual != test.expected {
+			t.Fatalf("Wrong auth for account %q; expected %+v, got %+v (%v)", test.name, test.expected, actual, err)
+		}
+	}
+}
+
+type tokenPathTestConf struct {
+	profile  string
+	account  string
+	expected string
+}
+
+var tokenPathTests = []tokenPathTestConf{
+	{"", "", "/cfg/turnout/tokens/default.json"},
+	{"chapter-a", "", "/cfg/turnout/tokens/chapter-a.json"},
+	{"chapter-a", "shared", "/cfg/turnout/tokens/accounts/shared.json"},
+}
+
+func TestTokenPath(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/cfg")
+	for _, test := range tokenPathTests {
+		if actual := TokenPath(test.profile, test.account); actual != filepath.FromSlash(test.expected) {
+			t.Fatalf("Wrong token path for %q/%q; expected %v, got %v", test.profile, test.account, test.expected, actual)
+		}
+	}
+}
+
+type lookupTestConf struct {
+	profile string
+	command string
+	key     string
+	value   string
+	source  string
+	ok      bool
+}
+
+var testLookupFile = &File{
+	Path: "turnout.yaml",
+	Commands: map[string]Section{
+		"common":   {"title-template": "Turnout {{.Date}} #{{.Group}}", "batch-size": 8},
+		"generate": {"source": "1top", "batch-size": 10, "share-with": []interface{}{"a@example.org", "b@example.org"}},
+	},
+	Profiles: map[string]map[string]Section{
+		"chapter-a": {
+			"common":   {"title-template": "Chapter A {{.Date}} #{{.Group}}"},
+			"generate": {"source": "1chapterA"},
+		},
+	},
+}
+
+var lookupTests = []lookupTestConf{
+	{"", "generate", "source", "1top", "turnout.yaml", true},
+	{"", "generate", "batch-size", "10", "turnout.yaml", true},
+	{"", "clean", "batch-size", "8", "turnout.yaml", true},
+	{"", "generate", "title-template", "Turnout {{.Date}} #{{.Group}}", "turnout.yaml", true},
+	{"", "generate", "share-with", "a@example.org,b@example.org", "turnout.yaml", true},
+	{"", "generate", "dry-run", "", "", false},
+	{"chapter-a", "generate", "source", "1chapterA", "profile chapter-a", true},
+	{"chapter-a", "clean", "title-template", "Chapter A {{.Date}} #{{.Group}}", "profile chapter-a", true},
+	{"chapter-a", "generate", "batch-size", "10", "turnout.yaml", true},
+	{"chapter-b", "generate", "source", "1top", "turnout.yaml", true},
+}
+
+func TestLookup(t *testing.T) {
+	for _, test := range lookupTests {
+		value, source, ok := testLookupFile.Lookup(test.profile, test.command, test.key)
+		if value != test.value || source != test.source || ok != test.ok {
+			t.Fatalf("Wrong lookup of %s %s in profile %q; expected %q from %q (%v), got %q from %q (%v)", test.command, test.key, test.profile, test.value, test.source, test.ok, value, source, ok)
+		}
+	}
+}
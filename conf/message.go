@@ -0,0 +1,48 @@
+package conf
+
+import (
+	"strings"
+	"text/template"
+	"time"
+)
+
+// MessageData is what a --message-template can refer to: the contact, and
+// the event and batch they're in.
+type MessageData struct {
+	FirstName string
+	Phone     string
+	Row       []string  // Every cell of the contact's source row, from the start of --read-range
+	Date      string    // As written in titles
+	EventDate time.Time // For other formats, e.g. {{.EventDate.Format "Monday"}}
+	Volunteer string    // Volunteer the batch is assigned to, if any
+	Group     int
+	GroupKey  string // See TitleData
+}
+
+// MessageTemplate renders the text each contact is sent.
+type MessageTemplate struct {
+	tmpl *template.Template
+}
+
+func ParseMessageTemplate(text string) (*MessageTemplate, error) {
+	tmpl, err := template.New("message").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &MessageTemplate{tmpl: tmpl}, nil
+}
+
+func (t *MessageTemplate) Render(data MessageData) (string, error) {
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	// Trailing newlines from YAML block scalars just get in the way in a cell
+	return strings.TrimRight(b.String(), "\n"), nil
+}
+
+// HasMessage reports whether generate renders a message per contact, from
+// either the template itself or a cell of the source holding one.
+func (c GenerationConfig) HasMessage() bool {
+	return c.MessageTemplate != "" || c.MessageTemplateRange != ""
+}
@@ -0,0 +1,142 @@
+package conf
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Columns generate can write into each batch, in the order given by --columns.
+// An empty name (or "-") leaves that column of the template alone.
+const (
+	ColumnName    = "name"
+	ColumnPhone   = "phone"
+	ColumnMessage = "message"
+	ColumnStatus  = "status"
+	ColumnSkip    = "-"
+)
+
+// NoTemplateSheet is --template-sheet's default. 0 is a real sheet ID (the
+// first tab, usually the contact list), so it can't mean "not set".
+const NoTemplateSheet = -1
+
+// DefaultColumns is the layout batches have always had: names in the first
+// column, numbers in the second.
+var DefaultColumns = []string{ColumnName, ColumnPhone}
+
+var knownColumns = []string{ColumnName, ColumnPhone, ColumnMessage, ColumnStatus}
+
+// What a status column's dropdown offers. Every contact starts out as the
+// first one.
+var StatusValues = []string{"Not contacted", "Texted", "Yes", "No", "Maybe", "Wrong number"}
+
+// How values are written, for --value-input. Raw cells are exactly what the
+// source had; user-entered ones are parsed as if typed in, so numbers become
+// numbers and formulas work.
+const (
+	ValueInputRaw         = "raw"
+	ValueInputUserEntered = "user-entered"
+)
+
+// What phone cells hold, for --phone-links: the number, or a link that dials
+// or texts it
+const (
+	PhoneLinksNone = "none"
+	PhoneLinksTel  = "tel"
+	PhoneLinksSMS  = "sms"
+)
+
+// Named ranges are letters, digits and underscores, and can't look like a cell
+var namedRangePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+var cellLikePattern = regexp.MustCompile(`^[A-Za-z]{1,3}[0-9]+$`)
+
+// TargetIsNamedRange reports whether --target-range names a named range in
+// the template rather than a tab and cell. A1 targets always have a tab.
+func (c GenerationConfig) TargetIsNamedRange() bool {
+	return !strings.Contains(c.TargetRange, "!")
+}
+
+// Where the output goes and how it's laid out
+func (c GenerationConfig) validateOutput() []error {
+	var errs []error
+	if c.TargetIsNamedRange() {
+		switch {
+		case !namedRangePattern.MatchString(c.TargetRange) || cellLikePattern.MatchString(c.TargetRange):
+			errs = append(errs, fmt.Errorf("target-range: %q is neither 'Tab!A2' nor a named range", c.TargetRange))
+		case c.TemplateSpreadsheetId == "":
+			// Copying a single tab leaves named ranges behind
+			errs = append(errs, fmt.Errorf("target-range: named ranges like %q only work with --template-spreadsheet; use 'Tab!A2'", c.TargetRange))
+		}
+	} else if target, err := ParseA1Range(c.TargetRange); err != nil {
+		errs = append(errs, fmt.Errorf("target-range: %v (expected something like 'Sheet1!A2')", err))
+	} else if strings.Contains(c.TargetRange, ":") && target.Width() != 0 && target.Width() < len(c.Columns) {
+		// Only a range can be too narrow; a single cell is just where writing starts
+		errs = append(errs, fmt.Errorf("target-range: %q is narrower than the %d columns being written", c.TargetRange, len(c.Columns)))
+	}
+
+	if c.ValueInput != ValueInputRaw && c.ValueInput != ValueInputUserEntered {
+		errs = append(errs, fmt.Errorf("value-input: must be %s or %s, got %q", ValueInputRaw, ValueInputUserEntered, c.ValueInput))
+	}
+	switch c.PhoneLinks {
+	case PhoneLinksNone:
+	case PhoneLinksTel, PhoneLinksSMS:
+		// Written raw, the formula would just be text
+		if c.ValueInput != ValueInputUserEntered {
+			errs = append(errs, fmt.Errorf("phone-links: %s links are formulas, so they need --value-input %s", c.PhoneLinks, ValueInputUserEntered))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("phone-links: must be %s, %s or %s, got %q", PhoneLinksNone, PhoneLinksTel, PhoneLinksSMS, c.PhoneLinks))
+	}
+
+	if c.MessageTemplate != "" && c.MessageTemplateRange != "" {
+		errs = append(errs, fmt.Errorf("message-template: pass either a template or --message-template-range, not both"))
+	} else if c.MessageTemplate != "" {
+		if _, err := ParseMessageTemplate(c.MessageTemplate); err != nil {
+			errs = append(errs, fmt.Errorf("message-template: %v", err))
+		}
+	} else if c.MessageTemplateRange != "" {
+		// One cell; the template is checked once it's been read
+		if _, err := ParseA1Range(c.MessageTemplateRange); err != nil || !strings.Contains(c.MessageTemplateRange, "!") {
+			errs = append(errs, fmt.Errorf("message-template-range: %q isn't a cell like 'messages!A1'", c.MessageTemplateRange))
+		}
+	}
+	if containsColumn(c.Columns, ColumnMessage) && !c.HasMessage() {
+		errs = append(errs, fmt.Errorf("columns: a %s column needs --message-template or --message-template-range", ColumnMessage))
+	}
+
+	if c.ProtectContacts && !containsColumn(c.Columns, ColumnName) && !containsColumn(c.Columns, ColumnPhone) {
+		errs = append(errs, fmt.Errorf("protect-contacts: there's no %s or %s column to protect", ColumnName, ColumnPhone))
+	}
+	if c.FreezeHeader && !c.TargetIsNamedRange() {
+		// Named ranges get checked once we know where they are
+		if target, err := ParseA1Range(c.TargetRange); err == nil && target.StartRow <= 1 {
+			errs = append(errs, fmt.Errorf("freeze-header: %q starts at the top, so there's no header row above it to freeze", c.TargetRange))
+		}
+	}
+
+	if len(c.Columns) == 0 {
+		errs = append(errs, fmt.Errorf("columns: need at least one, like %s", strings.Join(DefaultColumns, ",")))
+	}
+	seen := make(map[string]bool)
+	for _, col := range c.Columns {
+		if col == "" || col == ColumnSkip {
+			continue
+		}
+		if !containsColumn(knownColumns, col) {
+			errs = append(errs, fmt.Errorf("columns: unknown column %q; use %s, or - to skip one", col, strings.Join(knownColumns, ", ")))
+		} else if seen[col] {
+			errs = append(errs, fmt.Errorf("columns: %q is in there twice", col))
+		}
+		seen[col] = true
+	}
+	return errs
+}
+
+func containsColumn(columns []string, col string) bool {
+	for _, c := range columns {
+		if c == col {
+			return true
+		}
+	}
+	return false
+}
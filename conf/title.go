@@ -0,0 +1,132 @@
+package conf
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+const DefaultTitleTemplate = "IC Turnout - {{.Date}} - Group {{.Group}}"
+
+// TitleData is what a --title-template can refer to.
+type TitleData struct {
+	Date      string // As passed to --date
+	Group     int    // 1-based batch number
+	Volunteer string // Volunteer the batch is assigned to, if any
+	GroupKey  string // Value of the --group-idx column the batch's contacts share, if grouping
+	Count     int    // Number of contacts in this batch
+	Total     int    // Total number of batches in this run
+}
+
+// NoGroupIdx is --group-idx's default: contacts aren't grouped, and GroupKey
+// is empty.
+const NoGroupIdx = -1
+
+// TitleTemplate renders spreadsheet titles, and can work backwards from a date
+// to find the spreadsheets it rendered, so generate and clean stay inverses.
+type TitleTemplate struct {
+	tmpl *template.Template
+}
+
+func ParseTitleTemplate(text string) (*TitleTemplate, error) {
+	tmpl, err := template.New("title").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &TitleTemplate{tmpl: tmpl}, nil
+}
+
+func (t *TitleTemplate) Render(data TitleData) (string, error) {
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Values nothing real would produce, so we can find where each per-batch field
+// landed in the rendered title. Numbers have to stay numbers for printf & co.
+const (
+	sentinelGroup     = 917_364_528
+	sentinelCount     = 928_475_639
+	sentinelTotal     = 939_586_740
+	sentinelVolunteer = "\x00volunteer\x00"
+	sentinelGroupKey  = "\x00groupkey\x00"
+	sentinelDate      = "\x00date\x00"
+)
+
+var sentinelPattern = regexp.MustCompile(fmt.Sprintf("%d|%d|%d|%s|%s|%s",
+	sentinelGroup, sentinelCount, sentinelTotal,
+	regexp.QuoteMeta(sentinelVolunteer), regexp.QuoteMeta(sentinelGroupKey), regexp.QuoteMeta(sentinelDate)))
+
+// AnyDate can be passed as a date to Fragments and Matcher to leave the date
+// blank too, for finding every title regardless of date.
+const AnyDate = sentinelDate
+
+// Renders with every per-batch field (and the date, if it's AnyDate) swapped
+// for a sentinel, and returns the literal text between them plus the sentinels
+// themselves, alternating: literal, sentinel, literal, ..., literal.
+func (t *TitleTemplate) skeleton(date string) ([]string, error) {
+	rendered, err := t.Render(TitleData{
+		Date:      date,
+		Group:     sentinelGroup,
+		Volunteer: sentinelVolunteer,
+		GroupKey:  sentinelGroupKey,
+		Count:     sentinelCount,
+		Total:     sentinelTotal,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var parts []string
+	last := 0
+	for _, loc := range sentinelPattern.FindAllStringIndex(rendered, -1) {
+		parts = append(parts, rendered[last:loc[0]], rendered[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	return append(parts, rendered[last:]), nil
+}
+
+// Fragments renders the template for a date with every per-batch field blanked
+// out, and returns the literal pieces left over, in order. Every title
+// generated for that date contains all of them.
+func (t *TitleTemplate) Fragments(date string) ([]string, error) {
+	parts, err := t.skeleton(date)
+	if err != nil {
+		return nil, err
+	}
+	var fragments []string
+	for i := 0; i < len(parts); i += 2 {
+		if f := strings.TrimSpace(parts[i]); f != "" {
+			fragments = append(fragments, f)
+		}
+	}
+	return fragments, nil
+}
+
+// Matcher returns a regexp that matches exactly the titles the template could
+// have produced for date, to weed out looser Drive search results. With
+// AnyDate, the date is captured in the subexpression named "date".
+func (t *TitleTemplate) Matcher(date string) (*regexp.Regexp, error) {
+	parts, err := t.skeleton(date)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	b.WriteString("(?s)^")
+	dateSeen := false
+	for i, part := range parts {
+		switch {
+		case i%2 == 0:
+			b.WriteString(regexp.QuoteMeta(part))
+		case part == sentinelDate && !dateSeen:
+			b.WriteString("(?P<date>.+?)")
+			dateSeen = true
+		default:
+			b.WriteString(".*?")
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
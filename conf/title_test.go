@@ -0,0 +1,109 @@
+package conf
+
+import (
+	"testing"
+)
+
+type titleTestConf struct {
+	template  string
+	date      string
+	fragments []string
+	matches   []string
+	misses    []string
+}
+
+var titleTests = []titleTestConf{
+	{
+		DefaultTitleTemplate,
+		"1/5",
+		[]string{"IC Turnout - 1/5 - Group"},
+		[]string{"IC Turnout - 1/5 - Group 1", "IC Turnout - 1/5 - Group 12"},
+		[]string{"IC Turnout - 1/15 - Group 1", "My IC Turnout notes"},
+	},
+	{
+		`{{.Volunteer}}'s texts ({{.Date}}) {{printf "%02d" .Group}}/{{.Total}}`,
+		"Jan 5",
+		[]string{"'s texts (Jan 5)", "/"},
+		[]string{"Sam's texts (Jan 5) 03/12"},
+		[]string{"Sam's texts (Jan 6) 03/12", "Sam's texts (Jan 5) 03"},
+	},
+	{
+		"Turnout {{.Date}} - {{.GroupKey}} #{{.Group}}",
+		"1/5",
+		[]string{"Turnout 1/5 -", "#"},
+		[]string{"Turnout 1/5 - Precinct 12 #3", "Turnout 1/5 -  #1"},
+		[]string{"Turnout 1/6 - Precinct 12 #3", "Turnout 1/5 - Precinct 12"},
+	},
+}
+
+func TestTitleTemplateFragments(t *testing.T) {
+	for _, test := range titleTests {
+		tmpl, err := ParseTitleTemplate(test.template)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", test.template, err)
+		}
+		fragments, err := tmpl.Fragments(test.date)
+		if err != nil {
+			t.Fatalf("Failed to get fragments for %q: %v", test.template, err)
+		}
+		if len(fragments) != len(test.fragments) {
+			t.Fatalf("Wrong fragments for %q; expected %q, got %q", test.template, test.fragments, fragments)
+		}
+		for i := range fragments {
+			if fragments[i] != test.fragments[i] {
+				t.Fatalf("Wrong fragment %d for %q; expected %q, got %q", i, test.template, test.fragments[i], fragments[i])
+			}
+		}
+
+		matcher, err := tmpl.Matcher(test.date)
+		if err != nil {
+			t.Fatalf("Failed to get matcher for %q: %v", test.template, err)
+		}
+		for _, m := range test.matches {
+			if !matcher.MatchString(m) {
+				t.Fatalf("Expected %q to match template %q for %s", m, test.template, test.date)
+			}
+		}
+		for _, m := range test.misses {
+			if matcher.MatchString(m) {
+				t.Fatalf("Expected %q not to match template %q for %s", m, test.template, test.date)
+			}
+		}
+	}
+}
+
+func TestTitleTemplateRoundTrip(t *testing.T) {
+	tmpl, err := ParseTitleTemplate(DefaultTitleTemplate)
+	if err != nil {
+		t.Fatalf("Failed to parse default template: %v", err)
+	}
+	matcher, _ := tmpl.Matcher("2/9")
+	for group := 1; group <= 20; group++ {
+		title, err := tmpl.Render(TitleData{Date: "2/9", Group: group, Count: 10, Total: 20})
+		if err != nil {
+			t.Fatalf("Failed to render group %d: %v", group, err)
+		}
+		if !matcher.MatchString(title) {
+			t.Fatalf("Generated title %q doesn't match its own clean matcher", title)
+		}
+	}
+}
+
+func TestTitleTemplateAnyDate(t *testing.T) {
+	tmpl, _ := ParseTitleTemplate(DefaultTitleTemplate)
+	fragments, err := tmpl.Fragments(AnyDate)
+	if err != nil {
+		t.Fatalf("Failed to get fragments: %v", err)
+	}
+	if len(fragments) != 2 || fragments[0] != "IC Turnout -" || fragments[1] != "- Group" {
+		t.Fatalf("Wrong fragments; expected [IC Turnout - , - Group], got %q", fragments)
+	}
+	matcher, _ := tmpl.Matcher(AnyDate)
+	m := matcher.FindStringSubmatch("IC Turnout - 12/30 - Group 4")
+	if m == nil {
+		t.Fatalf("Expected title to match")
+	}
+	if date := m[matcher.SubexpIndex("date")]; date != "12/30" {
+		t.Fatalf("Wrong captured date; expected 12/30, got %q", date)
+	}
+}
@@ -0,0 +1,231 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Validate checks everything we can check without talking to Google, and
+// returns one error listing every problem so they can all be fixed in one go.
+func (c GenerationConfig) Validate() error {
+	var errs []error
+	if c.TurnoutSourceId == "" {
+		errs = append(errs, errors.New("source: a source spreadsheet ID is required (--source, "+EnvName("source")+", or config file)"))
+	}
+	errs = append(errs, validateDate(c.Date, c.DateLayout)...)
+	if c.BatchSize < 1 {
+		errs = append(errs, fmt.Errorf("batch-size: must be at least 1, got %d", c.BatchSize))
+	}
+	if c.LastPageFudgeFactor < 0 {
+		errs = append(errs, fmt.Errorf("last-page-fudge: must not be negative, got %d", c.LastPageFudgeFactor))
+	}
+	if c.Concurrency < 1 {
+		errs = append(errs, fmt.Errorf("concurrency: must be at least 1, got %d", c.Concurrency))
+	}
+	if c.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("timeout: can't be negative, got %v", c.Timeout))
+	}
+	errs = append(errs, validateTitleTemplate(c.TitleTemplate)...)
+	for _, v := range c.Volunteers {
+		if _, err := mail.ParseAddress(v); err != nil {
+			errs = append(errs, fmt.Errorf("volunteers: %q isn't an email or \"Name <email>\": %v", v, err))
+		}
+	}
+	for _, email := range c.ShareWith {
+		if addr, err := mail.ParseAddress(email); err != nil || addr.Name != "" {
+			errs = append(errs, fmt.Errorf("share-with: %q isn't a plain email address", email))
+		}
+	}
+	if c.Output != "table" && c.Output != "json" {
+		errs = append(errs, fmt.Errorf("output: must be table or json, got %q", c.Output))
+	}
+	if c.TemplateSheetId == NoTemplateSheet && c.TemplateSpreadsheetId == "" {
+		errs = append(errs, errors.New("template-sheet: a template sheet ID is required (--template-sheet, "+EnvName("template-sheet")+", or config file) unless --template-spreadsheet is given"))
+	} else if c.TemplateSheetId < NoTemplateSheet {
+		errs = append(errs, fmt.Errorf("template-sheet: sheet IDs are never negative, got %d", c.TemplateSheetId))
+	}
+	errs = append(errs, c.validateOutput()...)
+
+	readRange, err := ParseA1Range(c.TurnoutReadRange)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("read-range: %v (expected something like 'turnout-list!B2:E')", err))
+	}
+	width := readRange.Width()
+	for _, idx := range []struct {
+		name  string
+		value int
+	}{
+		{"do-turnout-idx", c.DoTurnoutIdx},
+		{"first-name-idx", c.FirstNameIdx},
+		{"phone-idx", c.PhoneIdx},
+		{"group-idx", c.GroupIdx},
+	} {
+		if idx.name == "group-idx" && idx.value == NoGroupIdx {
+			continue
+		}
+		if idx.value < 0 {
+			errs = append(errs, fmt.Errorf("%s: must not be negative, got %d", idx.name, idx.value))
+		} else if width > 0 && idx.value >= width {
+			errs = append(errs, fmt.Errorf("%s: %d is outside read-range %s, which is %d columns wide (valid: 0-%d)", idx.name, idx.value, c.TurnoutReadRange, width, width-1))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks the clean settings before we go looking for files.
+func (c CleanConfig) Validate() error {
+	var errs []error
+	if c.Date == "" && c.MatchPattern == "" && c.Q == "" && !c.IsRange() && c.OlderThan == "" {
+		errs = append(errs, errors.New("one of --date, --since/--until, --older-than, --match or --q is required"))
+	}
+	if c.OlderThan != "" {
+		if days, err := ParseAge(c.OlderThan); err != nil {
+			errs = append(errs, fmt.Errorf("older-than: %v", err))
+		} else if days == 0 {
+			errs = append(errs, errors.New("older-than: must be at least 1d"))
+		}
+		// Only the stamp keeps this from matching every old spreadsheet in Drive
+		if c.IncludeUnmanaged && c.Date == "" && c.MatchPattern == "" && c.Q == "" && !c.IsRange() {
+			errs = append(errs, errors.New("older-than: can't be used with --include-unmanaged unless --date, --since/--until, --match or --q narrow it down"))
+		}
+	}
+	if c.Q != "" {
+		if err := checkQueryParens(c.Q); err != nil {
+			errs = append(errs, fmt.Errorf("q: %v", err))
+		}
+	}
+	byTitle := c.MatchPattern == "" && c.Q == ""
+	if c.Date != "" && c.IsRange() {
+		errs = append(errs, errors.New("date: can't combine --date with --since/--until"))
+	}
+	if c.IsRange() && !byTitle {
+		errs = append(errs, errors.New("since/until: only work with date-based titles, not --match or --q"))
+	}
+	var since, until time.Time
+	now := time.Now()
+	for _, d := range []struct {
+		name  string
+		value string
+		t     *time.Time
+	}{{"since", c.Since, &since}, {"until", c.Until, &until}} {
+		if d.value == "" {
+			continue
+		}
+		t, err := ParseDate(d.value, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", d.name, err))
+		}
+		*d.t = t
+	}
+	if !since.IsZero() && !until.IsZero() && until.Before(since) {
+		errs = append(errs, fmt.Errorf("until: %s is before --since %s", c.Until, c.Since))
+	}
+	if c.IsRange() && byTitle {
+		errs = append(errs, validateDateLayout(c.DateLayout)...)
+	}
+	if (c.Date != "" || c.IsRange()) && byTitle {
+		date := AnyDate
+		if c.Date != "" {
+			errs = append(errs, validateDate(c.Date, c.DateLayout)...)
+			date = c.Date
+		}
+		if tmpl, err := ParseTitleTemplate(c.TitleTemplate); err != nil {
+			errs = append(errs, fmt.Errorf("title-template: %v", err))
+		} else if fragments, err := tmpl.Fragments(date); err != nil {
+			errs = append(errs, fmt.Errorf("title-template: %v", err))
+		} else if len(fragments) == 0 {
+			errs = append(errs, fmt.Errorf("title-template: %q has no fixed text to search for, so it would match every spreadsheet", c.TitleTemplate))
+		}
+	}
+	if c.Archive != "" && c.ArchiveFormat != "csv" && c.ArchiveFormat != "json" {
+		errs = append(errs, fmt.Errorf("archive-format: must be csv or json, got %q", c.ArchiveFormat))
+	}
+	if c.MatchPattern != "" && strings.TrimSpace(c.MatchPattern) == "" {
+		errs = append(errs, errors.New("match: pattern is only whitespace, which would match nearly everything"))
+	}
+	if c.Concurrency < 1 {
+		errs = append(errs, fmt.Errorf("concurrency: must be at least 1, got %d", c.Concurrency))
+	}
+	if c.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("timeout: can't be negative, got %v", c.Timeout))
+	}
+	return errors.Join(errs...)
+}
+
+func validateDate(date string, layout string) []error {
+	if date == "" {
+		return []error{errors.New("date: a date is required for spreadsheet titles (--date, " + EnvName("date") + ", or config file)")}
+	}
+	if _, err := ParseDate(date, time.Now()); err != nil {
+		return []error{fmt.Errorf("date: %v", err)}
+	}
+	return validateDateLayout(layout)
+}
+
+// The layout has to round-trip, or clean can't read dates back out of titles
+func validateDateLayout(layout string) []error {
+	sample := time.Date(2025, time.November, 23, 0, 0, 0, 0, time.Local)
+	formatted := sample.Format(layout)
+	parsed, err := ParseDateLayout(formatted, []string{layout}, sample)
+	if err != nil || parsed.Month() != sample.Month() || parsed.Day() != sample.Day() {
+		return []error{fmt.Errorf("date-layout: %q needs at least a month and day, e.g. \"1/2\" or \"2006-01-02\" (it gives %q)", layout, formatted)}
+	}
+	return nil
+}
+
+func validateTitleTemplate(text string) []error {
+	tmpl, err := ParseTitleTemplate(text)
+	if err != nil {
+		return []error{fmt.Errorf("title-template: %v", err)}
+	}
+	first, err := tmpl.Render(TitleData{Date: "1/5", Group: 1, Count: 10, Total: 2})
+	if err != nil {
+		return []error{fmt.Errorf("title-template: %v", err)}
+	}
+	second, _ := tmpl.Render(TitleData{Date: "1/5", Group: 2, Count: 10, Total: 2})
+	if first == second {
+		return []error{fmt.Errorf("title-template: %q gives every batch the same title; include {{.Group}}", text)}
+	}
+	return nil
+}
+
+// A --q gets wrapped in parentheses and and-ed with the trashed, managed and
+// mimeType clauses. Unbalanced parentheses could close that wrapper early and
+// "or" their way around them, so every one outside a quoted string has to
+// pair up.
+func checkQueryParens(q string) error {
+	depth := 0
+	var quote rune
+	escaped := false
+	for _, r := range q {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if r == '\\' {
+				escaped = true
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+			if depth < 0 {
+				return fmt.Errorf("%q closes a parenthesis it never opened", q)
+			}
+		}
+	}
+	if quote != 0 {
+		return fmt.Errorf("%q has an unterminated string", q)
+	}
+	if depth > 0 {
+		return fmt.Errorf("%q leaves a parenthesis open", q)
+	}
+	return nil
+}
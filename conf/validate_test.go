@@ -0,0 +1,359 @@
+package conf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type a1TestConf struct {
+	given    string
+	expected A1Range
+	width    int
+	wantErr  bool
+}
+
+var a1Tests = []a1TestConf{
+	{"turnout-list!B2:E", A1Range{Sheet: "turnout-list", StartCol: 2, StartRow: 2, EndCol: 5}, 4, false},
+	{"'My Sheet'!A1:B10", A1Range{Sheet: "My Sheet", StartCol: 1, StartRow: 1, EndCol: 2, EndRow: 10}, 2, false},
+	{"'Bob''s list'!A:D", A1Range{Sheet: "Bob's list", StartCol: 1, EndCol: 4}, 4, false},
+	{"AA1:AB", A1Range{StartCol: 27, StartRow: 1, EndCol: 28}, 2, false},
+	{"turnout-list", A1Range{Sheet: "turnout-list"}, 0, false},
+	{"Sheet1", A1Range{Sheet: "Sheet1"}, 0, false},
+	{"contacts", A1Range{Sheet: "contacts"}, 0, false},
+	{"ZZZ2", A1Range{StartCol: 18278, StartRow: 2, EndCol: 18278, EndRow: 2}, 1, false},
+	{"Sheet1!AAAA1", A1Range{}, 0, true},
+	{"Sheet1!C3", A1Range{Sheet: "Sheet1", StartCol: 3, StartRow: 3, EndCol: 3, EndRow: 3}, 1, false},
+	{"", A1Range{}, 0, true},
+	{"Sheet1!", A1Range{}, 0, true},
+	{"!A1:B", A1Range{}, 0, true},
+	{"Sheet1!E2:B", A1Range{}, 0, true},
+	{"Sheet1!A0:B", A1Range{}, 0, true},
+	{"Sheet1!A1:B2:C3", A1Range{}, 0, true},
+	{"'Unterminated!A1:B", A1Range{}, 0, true},
+}
+
+func TestParseA1Range(t *testing.T) {
+	for _, test := range a1Tests {
+		actual, err := ParseA1Range(test.given)
+		if test.wantErr {
+			if err == nil {
+				t.Fatalf("Expected error parsing %q, got %+v", test.given, actual)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error parsing %q: %v", test.given, err)
+		}
+		if actual != test.expected {
+			t.Fatalf("Wrong range for %q; expected %+v, got %+v", test.given, test.expected, actual)
+		}
+		if actual.Width() != test.width {
+			t.Fatalf("Wrong width for %q; expected %d, got %d", test.given, test.width, actual.Width())
+		}
+	}
+}
+
+func validGenerationConfig() GenerationConfig {
+	return GenerationConfig{
+		Date:                "1/5",
+		TurnoutSourceId:     "abc123",
+		TurnoutReadRange:    "turnout-list!B2:E",
+		DoTurnoutIdx:        0,
+		FirstNameIdx:        1,
+		PhoneIdx:            3,
+		GroupIdx:            NoGroupIdx,
+		BatchSize:           10,
+		LastPageFudgeFactor: 3,
+		Concurrency:         6,
+		TitleTemplate:       DefaultTitleTemplate,
+		DateLayout:          DefaultDateLayout,
+		Output:              "table",
+		TargetRange:         "Sheet1!A2:B",
+		Columns:             DefaultColumns,
+		ValueInput:          ValueInputRaw,
+		PhoneLinks:          PhoneLinksNone,
+	}
+}
+
+func TestGenerationConfigValidate(t *testing.T) {
+	if err := validGenerationConfig().Validate(); err != nil {
+		t.Fatalf("Expected default-ish config to be valid, got %v", err)
+	}
+
+	// Everything wrong at once should be reported at once
+	c := validGenerationConfig()
+	c.Date = ""
+	c.BatchSize = 0
+	c.PhoneIdx = 4
+	c.FirstNameIdx = -1
+	c.Concurrency = 0
+	c.Timeout = -time.Second
+	err := c.Validate()
+	if err == nil {
+		t.Fatalf("Expected errors for broken config")
+	}
+	expected := []string{"date:", "batch-size:", "phone-idx:", "first-name-idx:", "concurrency:", "timeout:"}
+	for _, e := range expected {
+		if !strings.Contains(err.Error(), e) {
+			t.Fatalf("Expected error mentioning %q, got %v", e, err)
+		}
+	}
+	var joined interface{ Unwrap() []error }
+	if !errors.As(err, &joined) || len(joined.Unwrap()) != len(expected) {
+		t.Fatalf("Expected %d separate errors, got %v", len(expected), err)
+	}
+
+	for _, target := range []string{"A2:B", "A2", "Contacts", "Sheet1!A2:A", "Sheet1!"} {
+		c = validGenerationConfig()
+		c.TargetRange = target
+		if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "target-range:") {
+			t.Fatalf("Expected target-range error for %q, got %v", target, err)
+		}
+	}
+
+	c = validGenerationConfig()
+	c.TitleTemplate = "Turnout {{.Date}}"
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "title-template:") {
+		t.Fatalf("Expected title-template error for template without group, got %v", err)
+	}
+
+	c = validGenerationConfig()
+	c.TurnoutReadRange = "turnout-list!E2:B"
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "read-range:") {
+		t.Fatalf("Expected read-range error, got %v", err)
+	}
+
+	c = validGenerationConfig()
+	c.TemplateSheetId = NoTemplateSheet
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "template-sheet:") {
+		t.Fatalf("Expected template-sheet error when no template is given, got %v", err)
+	}
+	c.TemplateSpreadsheetId = "1abc"
+	c.TargetRange = "Sheet1!A2"
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Expected a template spreadsheet to stand in for the template sheet, got %v", err)
+	}
+
+	c = validGenerationConfig()
+	c.GroupIdx = 4
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "group-idx:") {
+		t.Fatalf("Expected group-idx error for a column outside the read range, got %v", err)
+	}
+
+	// A whole tab is as wide as it needs to be
+	for _, readRange := range []string{"Sheet1", "contacts"} {
+		c = validGenerationConfig()
+		c.TurnoutReadRange = readRange
+		if err := c.Validate(); err != nil {
+			t.Fatalf("Expected read-range %q to be valid, got %v", readRange, err)
+		}
+	}
+}
+
+func TestCleanConfigValidate(t *testing.T) {
+	if err := (CleanConfig{Date: "1/5", TitleTemplate: DefaultTitleTemplate, DateLayout: DefaultDateLayout, Concurrency: 6}).Validate(); err != nil {
+		t.Fatalf("Expected valid clean config, got %v", err)
+	}
+	if err := (CleanConfig{Concurrency: 6}).Validate(); err == nil {
+		t.Fatalf("Expected error when no date, match or q given")
+	}
+	if err := (CleanConfig{Date: "1/5'", TitleTemplate: DefaultTitleTemplate, DateLayout: DefaultDateLayout, Concurrency: 6}).Validate(); err == nil {
+		t.Fatalf("Expected error for quote in date")
+	}
+}
+
+func TestCleanConfigValidateRange(t *testing.T) {
+	c := CleanConfig{Since: "2025-01-01", Until: "2025-02-01", TitleTemplate: DefaultTitleTemplate, DateLayout: DefaultDateLayout, Concurrency: 6}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Expected valid range, got %v", err)
+	}
+	c.Since, c.Until = c.Until, c.Since
+	if err := c.Validate(); err == nil {
+		t.Fatalf("Expected error for backwards range")
+	}
+	c = CleanConfig{Since: "-8w", MatchPattern: "Turnout", TitleTemplate: DefaultTitleTemplate, DateLayout: DefaultDateLayout, Concurrency: 6}
+	if err := c.Validate(); err == nil {
+		t.Fatalf("Expected error combining --since with --match")
+	}
+	c = CleanConfig{Since: "-8w", TitleTemplate: DefaultTitleTemplate, DateLayout: "Monday", Concurrency: 6}
+	if err := c.Validate(); err == nil {
+		t.Fatalf("Expected error for layout without month and day")
+	}
+}
+
+func TestCleanConfigValidateOlderThan(t *testing.T) {
+	c := CleanConfig{OlderThan: "8w", TitleTemplate: DefaultTitleTemplate, DateLayout: DefaultDateLayout, Concurrency: 6}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Expected --older-than alone to be valid, got %v", err)
+	}
+	c.IncludeUnmanaged = true
+	if err := c.Validate(); err == nil {
+		t.Fatalf("Expected error for --older-than with --include-unmanaged and nothing else")
+	}
+	c.MatchPattern = "IC Turnout"
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Expected --older-than with --match and --include-unmanaged to be valid, got %v", err)
+	}
+	c = CleanConfig{OlderThan: "8 fortnights", Concurrency: 6}
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "older-than:") {
+		t.Fatalf("Expected older-than error, got %v", err)
+	}
+}
+
+type outputTestConf struct {
+	targetRange string
+	template    string
+	columns     []string
+	wantErr     string
+}
+
+var outputTests = []outputTestConf{
+	{"Sheet1!A2:B", "", DefaultColumns, ""},
+	{"'Call list'!B4", "", []string{"phone", "-", "name"}, ""},
+	{"Contacts", "1abc", DefaultColumns, ""},
+	{"Contacts", "", DefaultColumns, "only work with --template-spreadsheet"},
+	{"B4", "1abc", DefaultColumns, "neither"},
+	{"Sheet1!A2:B", "", []string{"name", "phone", "-"}, "narrower"},
+	{"Sheet1!A2", "", []string{"name", "email"}, "unknown column"},
+	{"Sheet1!A2", "", []string{"name", "name"}, "twice"},
+	{"Sheet1!A2", "", nil, "at least one"},
+}
+
+func TestValidateOutput(t *testing.T) {
+	for _, test := range outputTests {
+		c := validGenerationConfig()
+		c.TargetRange, c.TemplateSpreadsheetId, c.Columns = test.targetRange, test.template, test.columns
+		err := c.Validate()
+		if test.wantErr == "" {
+			if err != nil {
+				t.Fatalf("Expected %q with columns %v to be valid, got %v", test.targetRange, test.columns, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Fatalf("Wrong error for %q with columns %v; expected %v, got %v", test.targetRange, test.columns, test.wantErr, err)
+		}
+	}
+}
+
+type phoneLinksTestConf struct {
+	valueInput string
+	phoneLinks string
+	wantErr    string
+}
+
+var phoneLinksTests = []phoneLinksTestConf{
+	{ValueInputUserEntered, PhoneLinksNone, ""},
+	{ValueInputUserEntered, PhoneLinksTel, ""},
+	{ValueInputUserEntered, PhoneLinksSMS, ""},
+	{ValueInputRaw, PhoneLinksSMS, "need --value-input user-entered"},
+	{"USER_ENTERED", PhoneLinksNone, "value-input"},
+	{ValueInputUserEntered, "whatsapp", "phone-links"},
+}
+
+func TestValidatePhoneLinks(t *testing.T) {
+	for _, test := range phoneLinksTests {
+		c := validGenerationConfig()
+		c.ValueInput, c.PhoneLinks = test.valueInput, test.phoneLinks
+		err := c.Validate()
+		if test.wantErr == "" {
+			if err != nil {
+				t.Fatalf("Expected %s writes with %s links to be valid, got %v", test.valueInput, test.phoneLinks, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Fatalf("Wrong error for %s writes with %s links; expected %v, got %v", test.valueInput, test.phoneLinks, test.wantErr, err)
+		}
+	}
+}
+
+type messageTestConf struct {
+	template      string
+	templateRange string
+	columns       []string
+	wantErr       string
+}
+
+var messageTests = []messageTestConf{
+	{"", "", DefaultColumns, ""},
+	{"Hi {{.FirstName}}", "", []string{"name", "phone", "message"}, ""},
+	{"", "messages!A1", []string{"name", "phone", "message"}, ""},
+	{"Hi {{.FirstName}}", "", DefaultColumns, ""},
+	{"", "", []string{"name", "phone", "message"}, "needs --message-template"},
+	{"Hi {{.FirstName", "", DefaultColumns, "message-template"},
+	{"Hi", "messages!A1", DefaultColumns, "not both"},
+	{"", "messages", DefaultColumns, "isn't a cell"},
+}
+
+func TestValidateMessage(t *testing.T) {
+	for _, test := range messageTests {
+		c := validGenerationConfig()
+		c.TargetRange = "Sheet1!A2"
+		c.MessageTemplate, c.MessageTemplateRange, c.Columns = test.template, test.templateRange, test.columns
+		err := c.Validate()
+		if test.wantErr == "" {
+			if err != nil {
+				t.Fatalf("Expected template %q / range %q to be valid, got %v", test.template, test.templateRange, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Fatalf("Wrong error for template %q / range %q; expected %v, got %v", test.template, test.templateRange, test.wantErr, err)
+		}
+	}
+}
+
+type outcomesTestConf struct {
+	targetRange     string
+	columns         []string
+	freezeHeader    bool
+	protectContacts bool
+	wantErr         string
+}
+
+var outcomesTests = []outcomesTestConf{
+	{"Sheet1!A2", []string{"name", "phone", "status"}, true, true, ""},
+	{"Sheet1!A1", DefaultColumns, true, false, "no header row"},
+	{"Sheet1!B", DefaultColumns, true, false, "no header row"},
+	{"Sheet1!A1", []string{"status"}, false, true, "no name or phone column"},
+	{"Sheet1!A2", []string{"name", "status", "status"}, false, false, "twice"},
+}
+
+func TestValidateOutcomes(t *testing.T) {
+	for _, test := range outcomesTests {
+		c := validGenerationConfig()
+		c.TargetRange, c.Columns, c.FreezeHeader, c.ProtectContacts = test.targetRange, test.columns, test.freezeHeader, test.protectContacts
+		err := c.Validate()
+		if test.wantErr == "" {
+			if err != nil {
+				t.Fatalf("Expected %q with columns %v to be valid, got %v", test.targetRange, test.columns, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Fatalf("Wrong error for %q with columns %v; expected %v, got %v", test.targetRange, test.columns, test.wantErr, err)
+		}
+	}
+}
+
+type queryParensTestConf struct {
+	q       string
+	wantErr bool
+}
+
+var queryParensTests = []queryParensTestConf{
+	{"name contains 'x'", false},
+	{"(name contains 'x' or name contains 'y') and starred = true", false},
+	{"name contains 'a)b' or name contains 'it\\'s ('", false},
+	{"name contains 'x') or ('y' in parents", true},
+	{"name contains 'x' or ('y' in parents", true},
+	{"name contains 'x", true},
+}
+
+func TestCheckQueryParens(t *testing.T) {
+	for _, test := range queryParensTests {
+		err := checkQueryParens(test.q)
+		if (err != nil) != test.wantErr {
+			t.Fatalf("Wrong result for %q; expected error %v, got %v", test.q, test.wantErr, err)
+		}
+	}
+	c := CleanConfig{Q: "name contains 'x') or ('y' in parents", Concurrency: 6}
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "q:") {
+		t.Fatalf("Expected q error for a clause escaping its parentheses, got %v", err)
+	}
+}
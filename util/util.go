@@ -38,3 +38,24 @@ func Delete(s *[]interface{}, i int) {
 	(*s)[i] = (*s)[len(*s)-1]
 	*s = (*s)[:len(*s)-1]
 }
+
+// RunConcurrently calls fn(0) through fn(n-1) with at most concurrency calls
+// in flight, and returns whatever errors came back (in no particular order).
+func RunConcurrently(n int, concurrency int, fn func(i int) error) []error {
+	sem := make(chan struct{}, max(concurrency, 1))
+	ch := make(chan error, n)
+	for i := range n {
+		go func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			ch <- fn(i)
+		}()
+	}
+	errs := make([]error, 0, n)
+	for range n {
+		if e := <-ch; e != nil {
+			errs = append(errs, e)
+		}
+	}
+	return errs
+}
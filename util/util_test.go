@@ -1,7 +1,10 @@
 package util
 
 import (
+	"errors"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestShuffleSlices(t *testing.T) {
@@ -103,3 +106,35 @@ func TestDelete(t *testing.T) {
 		}
 	}
 }
+
+func TestRunConcurrently(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	seen := make([]bool, 50)
+	errs := RunConcurrently(len(seen), 4, func(i int) error {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		seen[i] = true
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		if i%10 == 0 {
+			return errors.New("fail")
+		}
+		return nil
+	})
+	if len(errs) != 5 {
+		t.Fatalf("Wrong number of errors; expected %v, got %v", 5, len(errs))
+	}
+	if maxInFlight > 4 {
+		t.Fatalf("Too many calls at once; expected at most %v, got %v", 4, maxInFlight)
+	}
+	for i := range seen {
+		if !seen[i] {
+			t.Fatalf("fn was never called for %d", i)
+		}
+	}
+}